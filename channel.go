@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Channel is a shared chat channel subscribed to islands with its own
+// thresholds. Channels use the same filter settings as users.
+type Channel struct {
+	ID            string
+	GuildID       string
+	SellPrice     int
+	BuyPrice      int
+	ExcludePrices []int
+	MaxInQueue    int
+	MaxFee        int
+	FilterExpr    string
+	NotifyOn      IslandEventType
+	MentionRoleID string
+}
+
+func NewChannel(ID string, guildID string) Channel {
+	return Channel{
+		ID:            ID,
+		GuildID:       guildID,
+		ExcludePrices: []int{666},
+		MaxInQueue:    -1,
+		MaxFee:        -1,
+		NotifyOn:      defaultUserNotifyOn,
+	}
+}
+
+func (c Channel) Copy() Channel {
+	if c.ExcludePrices != nil {
+		c.ExcludePrices = append([]int(nil), c.ExcludePrices...)
+	}
+
+	return c
+}
+
+// Active reports whether the channel has anything to look for.
+func (c Channel) Active() bool {
+	return c.settings().HasDefaultWatch()
+}
+
+// settings returns the channel's filter settings as a user so channels share
+// the users' filters. The ID keeps the channel's history and compiled filter
+// apart from any user's.
+func (c Channel) settings() User {
+	return User{
+		ID:            channelHistoryID(c.ID),
+		Polling:       true,
+		SellPrice:     c.SellPrice,
+		BuyPrice:      c.BuyPrice,
+		ExcludePrices: c.ExcludePrices,
+		MaxInQueue:    c.MaxInQueue,
+		NotifyOn:      c.NotifyOn,
+		FilterExpr:    c.FilterExpr,
+		MaxFee:        c.MaxFee,
+	}
+}
+
+func channelHistoryID(ID string) string {
+	return "channel:" + ID
+}
+
+type ErrorChannelNotFound struct{}
+
+func (e *ErrorChannelNotFound) Error() string {
+	return "Channel was not found"
+}
+
+type SendChannelMessage func(channel Channel, message Message) error
+
+func (tf *TurnipFinder) Channel(ID string) (Channel, error) {
+	return tf.Channels.GetChannel(ID)
+}
+
+func (tf *TurnipFinder) SetChannel(channel Channel) error {
+	return tf.Channels.PutChannel(channel)
+}
+
+// SubscribedChannels returns the active channel subscriptions. There are none
+// while no channel transport is set, as islands could not be posted.
+func (tf *TurnipFinder) SubscribedChannels() ([]Channel, error) {
+	if tf.SendChannelMessage == nil {
+		return nil, nil
+	}
+
+	channels, err := tf.Channels.ListChannels()
+	if err != nil {
+		return nil, err
+	}
+
+	active := make([]Channel, 0, len(channels))
+	for _, channel := range channels {
+		if channel.Active() {
+			active = append(active, channel)
+		}
+	}
+
+	return active, nil
+}
+
+// ChannelFilter returns the filter for a channel's settings.
+func (tf *TurnipFinder) ChannelFilter(channel Channel) Filter {
+	return tf.UserFilter(channel.settings())
+}
+
+// SendChannelIslandEvent posts an island event to the channel, following the
+// same rules as SendUserIslandEvent.
+func (tf *TurnipFinder) SendChannelIslandEvent(channel Channel, event IslandEvent) error {
+	return tf.sendIslandEvent(islandRecipient{
+		historyID: channelHistoryID(channel.ID),
+		send: func(msg Message) error {
+			return tf.SendChannelMessage(channel, msg)
+		},
+	}, Watch{}, event)
+}
+
+var roleMentionRegex = regexp.MustCompile(`^(?:<@&)?(\d+)>?$`)
+
+// ParseRoleMention accepts a role mention like <@&123> or a role ID.
+func ParseRoleMention(mention string) (string, bool) {
+	match := roleMentionRegex.FindStringSubmatch(mention)
+	if match == nil {
+		return "", false
+	}
+
+	return match[1], true
+}
+
+func (c Channel) String() string {
+	msg := "This channel is not looking for islands"
+	if c.Active() {
+		msg = "This channel is looking for islands"
+		if c.SellPrice > 0 {
+			msg += fmt.Sprintf(" with a turnip price over %d", c.SellPrice)
+		}
+		if c.BuyPrice > 0 {
+			if c.SellPrice > 0 {
+				msg += " and"
+			}
+			msg += fmt.Sprintf(" with Daisy Mae selling turnips under %d", c.BuyPrice)
+		}
+		if c.FilterExpr != "" {
+			msg += fmt.Sprintf(" matching %s", c.FilterExpr)
+		}
+	}
+	if c.MentionRoleID != "" {
+		msg += fmt.Sprintf(", mentioning <@&%s>", c.MentionRoleID)
+	}
+
+	return msg
+}
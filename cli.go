@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	NotifierCLI = "cli"
+
+	cliAccountID = "local"
+	cliReset     = "\x1b[0m"
+	cliBold      = "\x1b[1m"
+)
+
+// CLI reads commands from In as a single local user and writes replies and
+// notifications to Out. Commands may be typed with or without a leading ! or
+// /. With Color set, island titles are coloured by their price tier.
+type CLI struct {
+	In    io.Reader
+	Out   io.Writer
+	Color bool
+	mu    sync.Mutex
+}
+
+func NewCLI(in io.Reader, out io.Writer) *CLI {
+	return &CLI{
+		In:  in,
+		Out: out,
+	}
+}
+
+func (c *CLI) Capabilities() NotifierCapabilities {
+	return NotifierCapabilities{Embeds: true}
+}
+
+// Send prints a message. The recipient is ignored since there is only one
+// local user.
+func (c *CLI) Send(ctx context.Context, recipient string, message Message) error {
+	text := strings.TrimRight(message.Text, "\n")
+	if c.Color && message.Embed != nil {
+		lines := strings.SplitN(text, "\n", 2)
+		lines[0] = cliColor(message.Embed.Color) + cliBold + lines[0] + cliReset
+		text = strings.Join(lines, "\n")
+	}
+
+	return c.print(text)
+}
+
+// Run handles commands until In is exhausted or ctx is done. Notifications
+// from the polling loop are printed between commands as they arrive.
+func (c *CLI) Run(ctx context.Context, tf *TurnipFinder) error {
+	scanner := bufio.NewScanner(c.In)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		line := strings.TrimLeft(strings.TrimSpace(scanner.Text()), "!/")
+		name, args := cutWord(line)
+		if name == "" {
+			continue
+		}
+
+		user, err := tf.TransportUser(NotifierCLI, cliAccountID, "")
+		if err != nil {
+			return err
+		}
+
+		err = tf.RunCommand(ChatCommandInput{
+			Name:  name,
+			Args:  args,
+			User:  user,
+			Reply: c.print,
+		})
+		if err != nil {
+			c.print(fmt.Sprintf("Error: %v", err))
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (c *CLI) print(text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := fmt.Fprintln(c.Out, text)
+	return err
+}
+
+// cliColor returns the escape sequence for a 24 bit colour.
+func cliColor(color int) string {
+	return fmt.Sprintf("\x1b[38;2;%d;%d;%dm", color>>16&0xFF, color>>8&0xFF, color&0xFF)
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCLIRun(t *testing.T) {
+	tf := New()
+	tf.RegisterDefaultCommands()
+
+	var out bytes.Buffer
+	cli := NewCLI(strings.NewReader("sell 180\n\n!format compact\n/status\nsel 1\n"), &out)
+	tf.AddNotifier(NotifierCLI, cli)
+
+	err := cli.Run(context.Background(), tf)
+	if err != nil {
+		t.Fatalf("Expected error to be nil but received %v", err)
+	}
+
+	user, err := tf.User("cli:local")
+	if err != nil {
+		t.Fatalf("Expected the local user to be added but received %v", err)
+	}
+	if user.SellPrice != 180 || user.Format != FormatCompact || !user.Polling {
+		t.Errorf("Unexpected user %+v", user)
+	}
+
+	replies := out.String()
+	for _, expected := range []string{"180", "sent to you as: compact", "You are currently looking for islands", "Unknown command !sel"} {
+		if !strings.Contains(replies, expected) {
+			t.Errorf("Expected output to contain %q but received %q", expected, replies)
+		}
+	}
+
+	out.Reset()
+	events := make([]IslandEvent, 0)
+	for _, island := range testIslands(10) {
+		events = append(events, IslandEvent{Type: IslandAdded, Island: island})
+	}
+	err = tf.Dispatch(events)
+	if err != nil {
+		t.Fatalf("Expected error to be nil but received %v", err)
+	}
+	if out.String() != "180 bells — https://example.com/island/8\n190 bells — https://example.com/island/9\n" {
+		t.Errorf("Unexpected notifications %q", out.String())
+	}
+}
+
+func TestCLISend(t *testing.T) {
+	island := Island{Name: "Nook", TurnipPrice: 612, InQueue: 4, MaxQueue: 20, URL: "https://example.com/island/1"}
+	message := New().RenderIslandMessage(island, FormatFull, "")
+
+	var out bytes.Buffer
+	cli := NewCLI(nil, &out)
+	cli.Send(context.Background(), cliAccountID, message)
+	if strings.Contains(out.String(), "\x1b[") || !strings.HasPrefix(out.String(), "[4/20] Nook") {
+		t.Errorf("Expected plain text without colour but received %q", out.String())
+	}
+
+	out.Reset()
+	cli.Color = true
+	cli.Send(context.Background(), cliAccountID, message)
+	if !strings.HasPrefix(out.String(), "\x1b[38;2;155;89;182m\x1b[1m[4/20] Nook") || !strings.Contains(out.String(), "Price: 612\x1b[0m\nURL:") {
+		t.Errorf("Expected the title to be coloured by price but received %q", out.String())
+	}
+}
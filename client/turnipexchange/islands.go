@@ -2,11 +2,24 @@ package turnipexchange
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 )
 
+// Values for IslandsRequest.Category.
+const (
+	CategoryTurnips = "turnips"
+	CategoryDaisy   = "daisy"
+)
+
+// Values for IslandsRequest.Fee.
+const (
+	FeeAny  = 0
+	FeeNone = 1
+)
+
 type IslandsRequest struct {
 	Islander string `json:"islander"`
 	Fee      int    `json:"fee"`
@@ -19,7 +32,7 @@ type IslandsResponse struct {
 	Islands []Island
 }
 
-func (c *Client) Islands(Islander string, Category string, Fee int) ([]Island, *http.Response, error) {
+func (c *Client) Islands(ctx context.Context, Islander string, Category string, Fee int) ([]Island, *http.Response, error) {
 	url := fmt.Sprintf("%s/islands/", c.BaseURL)
 	payload := &IslandsRequest{
 		Islander: Islander,
@@ -31,21 +44,34 @@ func (c *Client) Islands(Islander string, Category string, Fee int) ([]Island, *
 		return nil, nil, err
 	}
 
-	resp, err := http.Post(url, c.ContentType, bytes.NewBuffer(req))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(req))
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq.Header.Set("Content-Type", c.ContentType)
+
+	resp, err := c.HTTPClient.Do(httpReq)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	defer resp.Body.Close()
 
+	errResponse := ErrorWithResponse{Response: *resp, Request: *httpReq}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, resp, &ErrorTryLater{ErrorWithResponse: errResponse}
+	} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, resp, &ErrorUnexpectedStatus{StatusCode: resp.StatusCode, ErrorWithResponse: errResponse}
+	}
+
 	var data IslandsResponse
 	err = json.NewDecoder(resp.Body).Decode(&data)
 	if err != nil {
-		return nil, nil, err
+		return nil, resp, err
 	}
 
 	if !data.Success {
-		return nil, nil, &ErrorResponseNotSuccess{Success: data.Success, Message: data.Message}
+		return nil, resp, &ErrorResponseNotSuccess{Success: data.Success, Message: data.Message, ErrorWithResponse: errResponse}
 	}
 
 	return data.Islands, resp, nil
@@ -1,6 +1,9 @@
 package turnipexchange
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+)
 
 const defaultBaseURL = "https://api.turnip.exchange"
 const defaultContentType = "application/json"
@@ -8,6 +11,7 @@ const defaultContentType = "application/json"
 type Client struct {
 	BaseURL     string
 	ContentType string
+	HTTPClient  *http.Client
 }
 
 type Island struct {
@@ -52,6 +56,11 @@ type ErrorTryLater struct {
 	ErrorWithResponse
 }
 
+type ErrorUnexpectedStatus struct {
+	StatusCode int
+	ErrorWithResponse
+}
+
 func (e *ErrorResponseNotSuccess) Error() string {
 	return e.Message
 }
@@ -60,9 +69,14 @@ func (e *ErrorTryLater) Error() string {
 	return "Try Later"
 }
 
+func (e *ErrorUnexpectedStatus) Error() string {
+	return fmt.Sprintf("Unexpected status code %d", e.StatusCode)
+}
+
 func New() *Client {
 	return &Client{
 		BaseURL:     defaultBaseURL,
 		ContentType: defaultContentType,
+		HTTPClient:  http.DefaultClient,
 	}
 }
@@ -2,123 +2,843 @@ package main
 
 import (
 	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
 )
 
+const (
+	defaultHistoryCommandCount = 5
+	maxCommandSuggestions      = 3
+	maxCommandSuggestDistance  = 2
+)
+
 type ChatCommand func(tf *TurnipFinder, input ChatCommandInput) error
 
+// ChatCommandInput is passed to a command. Args is the raw message after the
+// command name and Values holds the arguments parsed from it, or from Options
+// when the transport gives arguments by name. ChannelID and
+// GuildID are set when the command was sent in a server channel, and Admin
+// when the sender may manage that channel.
 type ChatCommandInput struct {
-	Name  string
-	Args  string
-	User  User
-	Reply func(string) error
+	Name      string
+	Args      string
+	Options   map[string]string
+	Values    CommandValues
+	Command   Command
+	User      User
+	ChannelID string
+	GuildID   string
+	Admin     bool
+	Reply     func(string) error
 }
 
 func FormatCommandName(name string) string {
 	return strings.Trim(strings.ToLower(name), " ")
 }
 
+// AddCommand registers a command without metadata. It receives the message
+// unparsed in input.Args.
 func (tf *TurnipFinder) AddCommand(name string, f ChatCommand) {
-	mapName := FormatCommandName(name)
+	tf.RegisterCommand(Command{Name: name, Run: f})
+}
 
-	tf.commands[mapName] = f
+// RegisterCommand registers a command under its name and aliases.
+func (tf *TurnipFinder) RegisterCommand(cmd Command) {
+	cmd.Name = FormatCommandName(cmd.Name)
+
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+
+	tf.commands[cmd.Name] = cmd
+	for _, alias := range cmd.Aliases {
+		tf.commandAliases[FormatCommandName(alias)] = cmd.Name
+	}
 }
 
 func (tf *TurnipFinder) RegisterDefaultCommands() {
-	tf.AddCommand("help", CommandHelp)
-	tf.AddCommand("echo", CommandEcho)
-	tf.AddCommand("sell", CommandSell)
-	tf.AddCommand("buy", CommandBuy)
-	tf.AddCommand("maxqueue", CommandMaxQueue)
-	tf.AddCommand("stop", CommandStop)
-	tf.AddCommand("status", CommandStatus)
+	for _, cmd := range DefaultCommands() {
+		tf.RegisterCommand(cmd)
+	}
 }
 
-func (tf *TurnipFinder) GetCommand(name string) ChatCommand {
+// DefaultCommands returns the built in commands.
+func DefaultCommands() []Command {
+	return []Command{
+		{
+			Name:        "help",
+			Aliases:     []string{"commands"},
+			Description: "Lists the commands or explains one of them.",
+			Args:        []CommandArg{{Name: "command", Optional: true, Complete: completeCommandNames}},
+			Examples:    []string{"!help", "!help sell"},
+			Run:         CommandHelp,
+		}, {
+			Name:        "echo",
+			Description: "Replies with the message.",
+			Args:        []CommandArg{{Name: "message", Type: CommandArgText, Optional: true}},
+			Examples:    []string{"!echo hello"},
+			Run:         CommandEcho,
+		}, {
+			Name:        "sell",
+			Description: "Notifies you about islands buying turnips at or above a price.",
+			Args:        []CommandArg{{Name: "price", Type: CommandArgInt, Description: "the lowest price to be notified about"}},
+			Examples:    []string{"!sell 500"},
+			Run:         CommandSell,
+		}, {
+			Name:        "buy",
+			Description: "Notifies you about Daisy Mae selling turnips at or below a price.",
+			Args:        []CommandArg{{Name: "price", Type: CommandArgInt, Description: "the highest price to be notified about"}},
+			Examples:    []string{"!buy 95"},
+			Run:         CommandBuy,
+		}, {
+			Name:        "maxqueue",
+			Aliases:     []string{"queue"},
+			Description: "Only sends islands with at most this many people in the queue. Use -1 for no limit.",
+			Args:        []CommandArg{{Name: "size", Type: CommandArgInt}},
+			Examples:    []string{"!maxqueue 10"},
+			Run:         CommandMaxQueue,
+		}, {
+			Name:        "fee",
+			Description: "Limits the entry fee of islands you are sent.",
+			Args:        []CommandArg{{Name: "fee", Description: "none, any or the highest fee in bells"}},
+			Examples:    []string{"!fee none", "!fee 10000"},
+			Run:         CommandFee,
+		}, {
+			Name:        "filter",
+			Description: fmt.Sprintf("Sets, shows or clears a filter expression. Fields: %s.", strings.Join(FilterExpressionFields(), ", ")),
+			Args:        []CommandArg{{Name: "expression", Type: CommandArgText, Optional: true, Description: "a filter expression or clear"}},
+			Examples:    []string{"!filter price >= 450 && fee == 0 && queue < 20", "!filter clear"},
+			Run:         CommandFilter,
+		}, {
+			Name:        "watch",
+			Description: "Manages named watches, each with its own filter expression.",
+			Args: []CommandArg{
+				{Name: "action", Choices: []string{"add", "list", "remove", "pause", "resume"}},
+				{Name: "name", Optional: true, Complete: completeWatchNames},
+				{Name: "expression", Type: CommandArgText, Optional: true, Description: "optionally starting with sell or buy and a format preset"},
+			},
+			Examples: []string{"!watch add sell-high price>=550 queue<10", "!watch add cheap buy compact price<95", "!watch pause sell-high", "!watch list"},
+			Run:      CommandWatch,
+		}, {
+			Name:        "format",
+			Description: fmt.Sprintf("Sets how islands are sent to you. Presets: %s. Custom templates can use {{.Prefix}}, {{.Name}}, {{.Price}}, {{.Queue}}, {{.MaxQueue}}, {{.Fee}}, {{.URL}}, {{.Description}}, {{.Islander}}, {{.Category}}, {{.Hemisphere}}, {{.Listing}} and {{.Age}}.", strings.Join(FormatPresets(), ", ")),
+			Args:        []CommandArg{{Name: "format", Type: CommandArgText, Optional: true, Description: "a preset name or a custom template"}},
+			Examples:    []string{"!format compact", "!format {{.Price}} bells, queue {{queueBar .Queue .MaxQueue}} {{.URL}}"},
+			Run:         CommandFormat,
+		}, {
+			Name:        "channel",
+			Description: "Manages island posts in this server channel. Server admins only.",
+			Args: []CommandArg{
+				{Name: "action", Choices: []string{"watch", "filter", "mention", "stop", "status"}},
+				{Name: "settings", Type: CommandArgText, Optional: true, Description: "sell or buy and a price, a filter expression or clear, or a role or none"},
+			},
+			Examples: []string{"!channel watch sell 500", "!channel filter fee == 0", "!channel mention @turnips", "!channel stop"},
+			Run:      CommandChannel,
+		}, {
+			Name:        "notify",
+			Description: "Chooses which island events you are notified about.",
+			Args:        []CommandArg{{Name: "events", Repeated: true, Choices: []string{"added", "updated", "removed"}}},
+			Examples:    []string{"!notify added updated"},
+			Run:         CommandNotify,
+		}, {
+			Name:        "deliver",
+			Description: "Chooses where islands are sent to you. You can be sent them in several places at once.",
+			Args: []CommandArg{
+				{Name: "action", Choices: []string{"add", "confirm", "remove", "list"}},
+				{Name: "notifier", Optional: true, Complete: completeNotifierNames},
+				{Name: "recipient", Optional: true, Description: "the webhook URL, email address or confirmation code"},
+			},
+			Examples: []string{"!deliver add email me@example.com", "!deliver confirm email 123456", "!deliver add webhook https://example.com/hook", "!deliver remove discord", "!deliver list"},
+			Run:      CommandDeliver,
+		}, {
+			Name:        "stop",
+			Description: "Stops sending you islands.",
+			Args:        []CommandArg{},
+			Run:         CommandStop,
+		}, {
+			Name:        "history",
+			Description: "Lists the islands you were sent most recently.",
+			Args:        []CommandArg{{Name: "count", Type: CommandArgInt, Optional: true}},
+			Examples:    []string{"!history", "!history 10"},
+			Run:         CommandHistory,
+		}, {
+			Name:        "status",
+			Description: "Shows what you are looking for.",
+			Args:        []CommandArg{},
+			Run:         CommandStatus,
+		}, {
+			Name:        "sources",
+			Description: "Shows how polling each island site is going.",
+			Args:        []CommandArg{},
+			Run:         CommandSources,
+		},
+	}
+}
+
+// GetCommand returns the command registered under name or one of its aliases.
+func (tf *TurnipFinder) GetCommand(name string) (Command, bool) {
 	mapName := FormatCommandName(name)
-	if tf.commands[mapName] == nil {
-		return nil
+
+	tf.mu.RLock()
+	defer tf.mu.RUnlock()
+
+	if alias, ok := tf.commandAliases[mapName]; ok {
+		mapName = alias
 	}
+	cmd, ok := tf.commands[mapName]
+
+	return cmd, ok
+}
+
+// Commands returns the registered commands sorted by name.
+func (tf *TurnipFinder) Commands() []Command {
+	tf.mu.RLock()
+	defer tf.mu.RUnlock()
 
-	return tf.commands[mapName]
+	return sortedCommands(tf.commands)
 }
 
+func (tf *TurnipFinder) CommandNames() []string {
+	commands := tf.Commands()
+
+	names := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		names = append(names, cmd.Name)
+	}
+
+	return names
+}
+
+type ErrorCommandPanic struct {
+	Name  string
+	Value interface{}
+}
+
+func (e *ErrorCommandPanic) Error() string {
+	return fmt.Sprintf("Command %s panicked: %v", e.Name, e.Value)
+}
+
+// RunCommand runs the named command. Unknown commands are answered with
+// suggestions and a command that panics is reported to the user instead of
+// taking down the caller.
+// Arguments are parsed before the command runs and invalid arguments are
+// answered with the command's usage.
 func (tf *TurnipFinder) RunCommand(input ChatCommandInput) error {
-	cmd := tf.GetCommand(input.Name)
-	err := cmd(tf, input)
+	cmd, ok := tf.GetCommand(input.Name)
+	if !ok {
+		return tf.replyUnknownCommand(input)
+	}
+
+	var values CommandValues
+	var err error
+	if input.Options != nil {
+		values, err = cmd.ParseOptions(input.Options)
+	} else {
+		values, err = cmd.ParseArgs(input.Args)
+	}
 	if err != nil {
-		return err
+		return input.Reply(err.Error())
 	}
+	input.Command = cmd
+	input.Values = values
 
-	return nil
+	return runCommand(cmd.Run, tf, input)
+}
+
+func runCommand(cmd ChatCommand, tf *TurnipFinder, input ChatCommandInput) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Command %s panicked: %v\n%s", input.Name, r, debug.Stack())
+			err = &ErrorCommandPanic{Name: input.Name, Value: r}
+
+			replyErr := input.Reply(fmt.Sprintf("Sorry, something went wrong running !%s", FormatCommandName(input.Name)))
+			if replyErr != nil {
+				log.Println(replyErr)
+			}
+		}
+	}()
+
+	return cmd(tf, input)
+}
+
+func (tf *TurnipFinder) replyUnknownCommand(input ChatCommandInput) error {
+	msg := fmt.Sprintf("Unknown command !%s.", FormatCommandName(input.Name))
+
+	suggestions := tf.SuggestCommands(input.Name)
+	if len(suggestions) > 0 {
+		for idx, name := range suggestions {
+			suggestions[idx] = "!" + name
+		}
+		msg += fmt.Sprintf(" Did you mean %s?", strings.Join(suggestions, " or "))
+	} else {
+		msg += " Send !help for a list of commands."
+	}
+
+	return input.Reply(msg)
+}
+
+// SuggestCommands returns the registered commands closest to name by edit
+// distance. Only commands tied for the nearest distance are suggested.
+func (tf *TurnipFinder) SuggestCommands(name string) []string {
+	name = FormatCommandName(name)
+
+	best := maxCommandSuggestDistance + 1
+	suggestions := make([]string, 0)
+	for _, command := range tf.CommandNames() {
+		distance := editDistance(name, command)
+		if distance >= len(command) || distance > best {
+			continue
+		}
+		if distance < best {
+			best = distance
+			suggestions = suggestions[:0]
+		}
+		suggestions = append(suggestions, command)
+	}
+
+	sort.Strings(suggestions)
+
+	if len(suggestions) > maxCommandSuggestions {
+		suggestions = suggestions[:maxCommandSuggestions]
+	}
+
+	return suggestions
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			curr[j] = minInt(prev[j]+1, minInt(curr[j-1]+1, prev[j-1]+cost))
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
 }
 
 func CommandEcho(tf *TurnipFinder, input ChatCommandInput) error {
-	return input.Reply(input.Args)
+	return input.Reply(input.String("message"))
 }
 
 func CommandHelp(tf *TurnipFinder, input ChatCommandInput) error {
-	arrCommands := make([]string, 0)
-	for name := range tf.commands {
-		arrCommands = append(arrCommands, name)
+	if input.Has("command") {
+		name := strings.TrimPrefix(input.String("command"), "!")
+		cmd, ok := tf.GetCommand(name)
+		if !ok {
+			return tf.replyUnknownCommand(ChatCommandInput{Name: name, Reply: input.Reply})
+		}
+
+		return input.Reply(cmd.Help())
+	}
+
+	lines := []string{"Commands:"}
+	for _, cmd := range tf.Commands() {
+		line := cmd.Usage()
+		if cmd.Description != "" {
+			line += " - " + cmd.Description
+		}
+		lines = append(lines, line)
 	}
-	return input.Reply(fmt.Sprintf("Commands: %s", strings.Join(arrCommands, ", ")))
+	lines = append(lines, "Send !help <command> for details.")
+
+	return input.Reply(strings.Join(lines, "\n"))
 }
 
 func CommandSell(tf *TurnipFinder, input ChatCommandInput) error {
-	price, err := strconv.Atoi(input.Args)
+	price := input.Int("price")
+	if price < tf.MinTurnipPriceAllowed || price > tf.MaxTurnipPriceAllowed {
+		return input.ReplyUsage(fmt.Sprintf("Sell price must be between %d and %d", tf.MinTurnipPriceAllowed, tf.MaxTurnipPriceAllowed))
+	}
+
+	input.User.SellPrice = price
+	input.User.Polling = true
+	err := tf.SetUser(input.User)
 	if err != nil {
-		return input.Reply("Usage: !sell [minPrice]")
+		return err
 	}
 
+	return input.Reply(fmt.Sprintf("I will notify you about islands buying turnips above %d", price))
+}
+
+func CommandBuy(tf *TurnipFinder, input ChatCommandInput) error {
+	price := input.Int("price")
 	if price < tf.MinTurnipPriceAllowed || price > tf.MaxTurnipPriceAllowed {
-		err := input.Reply(fmt.Sprintf("Sell price must be between %d and %d", tf.MinTurnipPriceAllowed, tf.MaxTurnipPriceAllowed))
+		return input.ReplyUsage(fmt.Sprintf("Buy price must be between %d and %d", tf.MinTurnipPriceAllowed, tf.MaxTurnipPriceAllowed))
+	}
+
+	input.User.BuyPrice = price
+	input.User.Polling = true
+	err := tf.SetUser(input.User)
+	if err != nil {
+		return err
+	}
+
+	return input.Reply(fmt.Sprintf("I will notify you about Daisy Mae selling turnips below %d", price))
+}
+
+func CommandMaxQueue(tf *TurnipFinder, input ChatCommandInput) error {
+	maxInQueue := input.Int("size")
+	if maxInQueue < -1 {
+		return input.ReplyUsage("Queue size must be -1 or more")
+	}
+
+	input.User.MaxInQueue = maxInQueue
+	err := tf.SetUser(input.User)
+	if err != nil {
+		return err
+	}
+	return input.Reply(fmt.Sprintf("I will only send items that have %d users in the queue or less", maxInQueue))
+}
+
+func CommandFee(tf *TurnipFinder, input ChatCommandInput) error {
+	arg := strings.ToLower(input.String("fee"))
+	maxFee := 0
+	switch arg {
+	case "none":
+		maxFee = 0
+	case "any":
+		maxFee = -1
+	default:
+		var err error
+		maxFee, err = strconv.Atoi(arg)
+		if err != nil || maxFee < 0 {
+			return input.ReplyUsage("Fee must be none, any or a number of bells")
+		}
+	}
+
+	input.User.MaxFee = maxFee
+	err := tf.SetUser(input.User)
+	if err != nil {
+		return err
+	}
+
+	switch maxFee {
+	case -1:
+		return input.Reply("I will send islands with any entry fee")
+	case 0:
+		return input.Reply("I will only send islands without an entry fee")
+	}
+
+	return input.Reply(fmt.Sprintf("I will only send islands with an entry fee of %d or less", maxFee))
+}
+
+func CommandFilter(tf *TurnipFinder, input ChatCommandInput) error {
+	source := input.String("expression")
+	if source == "" {
+		if input.User.FilterExpr == "" {
+			return input.Reply(input.Command.Help())
+		}
+
+		return input.Reply(fmt.Sprintf("Your filter is: %s", input.User.FilterExpr))
+	}
+
+	if strings.EqualFold(source, "clear") {
+		input.User.FilterExpr = ""
+		err := tf.SetUser(input.User)
 		if err != nil {
 			return err
 		}
+
+		return input.Reply("Your filter has been cleared")
 	}
 
-	input.User.SellPrice = price
+	_, err := ParseFilterExpression(source)
+	if err != nil {
+		return input.Reply(fmt.Sprintf("Could not use that filter: %v", err))
+	}
+
+	input.User.FilterExpr = source
 	input.User.Polling = true
-	tf.SetUser(input.User)
+	err = tf.SetUser(input.User)
+	if err != nil {
+		return err
+	}
 
-	return input.Reply(fmt.Sprintf("I will notify you about islands buying turnips above %d", price))
+	return input.Reply(fmt.Sprintf("I will notify you about islands matching: %s", source))
 }
 
-func CommandBuy(tf *TurnipFinder, input ChatCommandInput) error {
-	price, err := strconv.Atoi(input.Args)
+// CommandFormat shows or sets the format the user is sent islands in. Custom
+// templates are checked against a sample island before they are saved.
+func CommandFormat(tf *TurnipFinder, input ChatCommandInput) error {
+	format := input.String("format")
+	if format == "" {
+		current := input.User.Format
+		if current == "" {
+			current = FormatFull
+		}
+
+		return input.Reply(fmt.Sprintf("Your format is: %s\nPresets: %s", current, strings.Join(FormatPresets(), ", ")))
+	}
+
+	if _, ok := formatPresets[strings.ToLower(format)]; ok {
+		format = strings.ToLower(format)
+	}
+
+	_, err := ParseIslandTemplate(format)
 	if err != nil {
-		return input.Reply("Usage: !buy [minPrice]")
+		return input.Reply(fmt.Sprintf("Could not use that format: %v", err))
 	}
 
-	if price < tf.MinTurnipPriceAllowed || price > tf.MaxTurnipPriceAllowed {
-		return input.Reply(fmt.Sprintf("Sell price must be between %d and %d", tf.MinTurnipPriceAllowed, tf.MaxTurnipPriceAllowed))
+	input.User.Format = format
+	err = tf.SetUser(input.User)
+	if err != nil {
+		return err
 	}
 
-	input.User.BuyPrice = price
-	input.User.Polling = true
-	tf.SetUser(input.User)
+	return input.Reply(fmt.Sprintf("Islands will be sent to you as: %s", format))
+}
 
-	return input.Reply(fmt.Sprintf("I will notify you about islands selling turnips below %d", price))
+// CommandWatch manages the user's named watches:
+//
+//	!watch add <name> [sell|buy] [full|compact|mobile] <expression>
+//	!watch list
+//	!watch remove <name>
+//	!watch pause <name>
+//	!watch resume <name>
+func CommandWatch(tf *TurnipFinder, input ChatCommandInput) error {
+	action := input.String("action")
+	if action == "list" {
+		if len(input.User.Watches) == 0 {
+			return input.Reply("You have no watches")
+		}
+
+		lines := make([]string, 0, len(input.User.Watches))
+		for _, watch := range input.User.Watches {
+			lines = append(lines, watch.String())
+		}
+
+		return input.Reply(fmt.Sprintf("Your watches:\n%s", strings.Join(lines, "\n")))
+	}
+
+	if !input.Has("name") {
+		return input.ReplyUsage("Missing name")
+	}
+
+	name, ok := FormatWatchName(input.String("name"))
+	if !ok {
+		return input.Reply("Watch names may only use letters, numbers, - and _ and be up to 32 characters long")
+	}
+	idx := input.User.WatchIndex(name)
+
+	var msg string
+	switch action {
+	case "add":
+		watch := Watch{Name: name, Listing: ListingSell}
+		rest := input.String("expression")
+	options:
+		for {
+			option, next := cutWord(rest)
+			switch option = strings.ToLower(option); option {
+			case "sell":
+				watch.Listing = ListingSell
+			case "buy":
+				watch.Listing = ListingBuy
+			case FormatFull, FormatCompact, FormatMobile:
+				watch.Style = option
+			default:
+				break options
+			}
+			rest = next
+		}
+
+		watch.Expr = rest
+		if watch.Expr == "" {
+			return input.ReplyUsage("Missing expression")
+		}
+
+		_, err := ParseFilterExpression(watch.Expr)
+		if err != nil {
+			return input.Reply(fmt.Sprintf("Could not use that filter: %v", err))
+		}
+
+		if idx >= 0 {
+			input.User.Watches[idx] = watch
+			msg = fmt.Sprintf("Updated watch %s", watch)
+		} else if len(input.User.Watches) >= defaultMaxUserWatches {
+			return input.Reply(fmt.Sprintf("You can have at most %d watches", defaultMaxUserWatches))
+		} else {
+			input.User.Watches = append(input.User.Watches, watch)
+			msg = fmt.Sprintf("Added watch %s", watch)
+		}
+		input.User.Polling = true
+	case "remove", "pause", "resume":
+		if idx < 0 {
+			return input.Reply(fmt.Sprintf("You have no watch named %s", name))
+		}
+
+		switch action {
+		case "remove":
+			input.User.Watches = append(input.User.Watches[:idx], input.User.Watches[idx+1:]...)
+			msg = fmt.Sprintf("Removed watch %s", name)
+		case "pause":
+			input.User.Watches[idx].Paused = true
+			msg = fmt.Sprintf("Paused watch %s", name)
+		case "resume":
+			input.User.Watches[idx].Paused = false
+			input.User.Polling = true
+			msg = fmt.Sprintf("Resumed watch %s", name)
+		}
+	}
+
+	err := tf.SetUser(input.User)
+	if err != nil {
+		return err
+	}
+
+	return input.Reply(msg)
 }
 
-func CommandMaxQueue(tf *TurnipFinder, input ChatCommandInput) error {
-	maxInQueue, err := strconv.Atoi(input.Args)
+// CommandChannel manages the subscription of the server channel the command
+// was sent in.
+func CommandChannel(tf *TurnipFinder, input ChatCommandInput) error {
+	if input.GuildID == "" || input.ChannelID == "" {
+		return input.Reply("Send !channel in the server channel islands should be posted to")
+	}
+	if !input.Admin {
+		return input.Reply("Only server admins can change channel notifications")
+	}
+
+	channel, err := tf.Channel(input.ChannelID)
 	if err != nil {
-		return input.Reply("Usage: !maxqueue [maxUsersInQueue]")
+		channel = NewChannel(input.ChannelID, input.GuildID)
 	}
 
-	input.User.MaxInQueue = maxInQueue
+	settings := input.String("settings")
+	switch input.String("action") {
+	case "status":
+		return input.Reply(channel.String())
+	case "stop":
+		err := tf.Channels.DeleteChannel(channel.ID)
+		if err != nil {
+			return err
+		}
 
-	tf.SetUser(input.User)
-	return input.Reply(fmt.Sprintf("I will only send items that have %d users in the queue or less", maxInQueue))
+		return input.Reply("This channel has stopped looking for islands")
+	case "watch":
+		listing, rest := cutWord(settings)
+		listing = strings.ToLower(listing)
+		price, err := strconv.Atoi(rest)
+		if err != nil || (listing != "sell" && listing != "buy") {
+			return input.ReplyUsage("Watch needs sell or buy and a price, for example !channel watch sell 500")
+		}
+		if price < tf.MinTurnipPriceAllowed || price > tf.MaxTurnipPriceAllowed {
+			return input.ReplyUsage(fmt.Sprintf("Price must be between %d and %d", tf.MinTurnipPriceAllowed, tf.MaxTurnipPriceAllowed))
+		}
+
+		if listing == "sell" {
+			channel.SellPrice = price
+		} else {
+			channel.BuyPrice = price
+		}
+	case "filter":
+		if strings.EqualFold(settings, "clear") {
+			channel.FilterExpr = ""
+		} else {
+			_, err := ParseFilterExpression(settings)
+			if err != nil {
+				return input.Reply(fmt.Sprintf("Could not use that filter: %v", err))
+			}
+			channel.FilterExpr = settings
+		}
+	case "mention":
+		if strings.EqualFold(settings, "none") {
+			channel.MentionRoleID = ""
+		} else {
+			roleID, ok := ParseRoleMention(settings)
+			if !ok {
+				return input.ReplyUsage("Mention needs a role or none")
+			}
+			channel.MentionRoleID = roleID
+		}
+	}
+
+	err = tf.SetChannel(channel)
+	if err != nil {
+		return err
+	}
+
+	return input.Reply(channel.String())
+}
+
+func CommandNotify(tf *TurnipFinder, input ChatCommandInput) error {
+	notifyOn := IslandUnchanged
+	for _, field := range input.Strings("events") {
+		eventType, _ := ParseIslandEventType(field)
+		notifyOn |= eventType
+	}
+
+	input.User.NotifyOn = notifyOn
+	err := tf.SetUser(input.User)
+	if err != nil {
+		return err
+	}
+
+	return input.Reply(fmt.Sprintf("I will notify you when islands are %s", notifyOn))
+}
+
+// CommandDeliver manages where the user is sent islands. Adding a notifier
+// keeps the places the user is already sent islands, starting with the
+// default. The transport the user signed up with always sends to the user
+// themselves. Recipients of a RecipientConfirmer are only saved once the user
+// sends back the code they were sent.
+func CommandDeliver(tf *TurnipFinder, input ChatCommandInput) error {
+	targets := tf.NotifyTargets(input.User)
+
+	action := input.String("action")
+	if action == "list" {
+		if len(targets) == 0 {
+			return input.Reply("Islands are not sent to you anywhere yet")
+		}
+
+		lines := make([]string, 0, len(targets))
+		for _, target := range targets {
+			lines = append(lines, target.String())
+		}
+
+		return input.Reply(fmt.Sprintf("Islands are sent to you by:\n%s", strings.Join(lines, "\n")))
+	}
+
+	name := strings.ToLower(input.String("notifier"))
+	if name == "" {
+		return input.ReplyUsage("Missing notifier")
+	}
+	notifier, err := tf.Notifier(name)
+	if err != nil {
+		return input.Reply(fmt.Sprintf("There is no notifier named %s. Choose from %s", name, strings.Join(tf.NotifierNames(), ", ")))
+	}
+
+	kept := make([]NotifyTarget, 0, len(targets))
+	for _, target := range targets {
+		if target.Notifier != name {
+			kept = append(kept, target)
+		}
+	}
+
+	switch action {
+	case "add":
+		recipient := input.String("recipient")
+		own, isOwn := tf.defaultNotifyTarget(input.User)
+		isOwn = isOwn && own.Notifier == name
+		if isOwn {
+			recipient = own.Recipient
+		}
+		if recipient == "" {
+			return input.ReplyUsage("Missing recipient")
+		}
+		if validator, ok := notifier.(RecipientValidator); ok {
+			err := validator.ValidateRecipient(recipient)
+			if err != nil {
+				return input.Reply(fmt.Sprintf("Could not use that recipient: %v", err))
+			}
+		}
+
+		target := NotifyTarget{Notifier: name, Recipient: recipient}
+		if confirmer, ok := notifier.(RecipientConfirmer); ok && !isOwn {
+			err := tf.SendConfirmation(input.User, target, confirmer)
+			if _, recent := err.(*ErrorConfirmationRecent); recent {
+				return input.Reply(err.Error())
+			} else if err != nil {
+				log.Printf("Could not send a confirmation code to %s: %v\n", target, err)
+				return input.Reply(fmt.Sprintf("Could not send a confirmation code to %s", recipient))
+			}
+
+			return input.Reply(fmt.Sprintf("Sent a confirmation code to %s. Send !deliver confirm %s <code> to start sending islands there", recipient, name))
+		}
+
+		input.User.NotifyVia = append(kept, target)
+	case "confirm":
+		code := input.String("recipient")
+		if code == "" {
+			return input.ReplyUsage("Missing confirmation code")
+		}
+		target, err := tf.ConfirmNotifyTarget(input.User, name, code)
+		if err != nil {
+			return input.Reply(err.Error())
+		}
+
+		input.User.NotifyVia = append(kept, target)
+	case "remove":
+		if len(kept) == len(targets) {
+			return input.Reply(fmt.Sprintf("Islands are not sent to you by %s", name))
+		}
+		if len(kept) == 0 {
+			return input.Reply("You need at least one notifier. Send !stop to stop being sent islands")
+		}
+
+		input.User.NotifyVia = kept
+	}
+
+	err = tf.SetUser(input.User)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(input.User.NotifyVia))
+	for _, target := range input.User.NotifyVia {
+		names = append(names, target.Notifier)
+	}
+
+	return input.Reply(fmt.Sprintf("Islands will be sent to you by %s", strings.Join(names, ", ")))
+}
+
+func CommandHistory(tf *TurnipFinder, input ChatCommandInput) error {
+	count := defaultHistoryCommandCount
+	if input.Has("count") {
+		count = input.Int("count")
+		if count < 1 {
+			return input.ReplyUsage("Count must be 1 or more")
+		}
+	}
+
+	history, err := tf.History.History(input.User.ID)
+	if err != nil {
+		return err
+	}
+
+	if len(history) == 0 {
+		return input.Reply("You have not been sent any islands yet")
+	}
+
+	lines := make([]string, 0, count)
+	for idx := len(history) - 1; idx >= 0 && len(lines) < count; idx-- {
+		entry := history[idx]
+		lines = append(lines, fmt.Sprintf("%s\tPrice: %d\t%s\tURL: %s", entry.SentAt.Format("Jan 2 15:04"), entry.TurnipPrice, entry.Name, entry.URL))
+	}
+
+	return input.Reply(strings.Join(lines, "\n"))
 }
 
 func CommandStop(tf *TurnipFinder, input ChatCommandInput) error {
 	input.User.Polling = false
 
-	tf.SetUser(input.User)
+	err := tf.SetUser(input.User)
+	if err != nil {
+		return err
+	}
 	return input.Reply("You have stopped looking for an island.")
 }
 
@@ -129,10 +849,37 @@ func CommandStatus(tf *TurnipFinder, input ChatCommandInput) error {
 
 		if input.User.SellPrice > 0 {
 			msgPolling += fmt.Sprintf(" with a turnip price over %d", input.User.SellPrice)
-		} else if input.User.BuyPrice > 0 {
-			msgPolling += fmt.Sprintf(" with a turnip price under %d", input.User.BuyPrice)
+		}
+		if input.User.BuyPrice > 0 {
+			if input.User.SellPrice > 0 {
+				msgPolling += " and"
+			}
+			msgPolling += fmt.Sprintf(" with Daisy Mae selling turnips under %d", input.User.BuyPrice)
+		}
+
+		if input.User.FilterExpr != "" {
+			msgPolling += fmt.Sprintf(" matching %s", input.User.FilterExpr)
+		}
+
+		if active := len(input.User.ActiveWatches()); active > 0 {
+			msgPolling += fmt.Sprintf(" (%d of %d watches active)", active, len(input.User.Watches))
 		}
 	}
 
 	return input.Reply(msgPolling)
 }
+
+func CommandSources(tf *TurnipFinder, input ChatCommandInput) error {
+	stats := tf.SourceStats()
+	if len(stats) == 0 {
+		return input.Reply("No island sites are being polled")
+	}
+
+	now := tf.now()
+	lines := make([]string, 0, len(stats))
+	for _, sourceStats := range stats {
+		lines = append(lines, sourceStats.Status(now))
+	}
+
+	return input.Reply(strings.Join(lines, "\n"))
+}
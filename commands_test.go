@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"log"
+	"reflect"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 )
 
 type mockedReply struct {
@@ -61,9 +65,11 @@ func TestCommandEcho(t *testing.T) {
 	for _, tcase := range testTable {
 		t.Run(tcase.Name, func(t *testing.T) {
 			tf := New()
+			tf.RegisterDefaultCommands()
 			mock, reply := mockReply(tcase.ReplyShouldError)
+			tcase.Input.Name = "echo"
 			tcase.Input.Reply = reply
-			err := CommandEcho(tf, tcase.Input)
+			err := tf.RunCommand(tcase.Input)
 
 			if err != nil && !tcase.ExpectedError {
 				t.Errorf("Expected nil to be returned by received an error")
@@ -166,15 +172,17 @@ func TestCommandSell(t *testing.T) {
 			if tcase.tf == nil {
 				tcase.tf = New()
 			}
+			tcase.tf.RegisterDefaultCommands()
 
 			SetupUser(tcase.tf, &tcase.Input.User)
 
-			log.Println(tcase.tf.Users[userID])
+			log.Println(tcase.tf.User(userID))
 
 			mock, reply := mockReply(tcase.ReplyShouldError)
+			tcase.Input.Name = "sell"
 			tcase.Input.Reply = reply
-			err := CommandSell(tcase.tf, tcase.Input)
-			log.Println(tcase.tf.Users[userID])
+			err := tcase.tf.RunCommand(tcase.Input)
+			log.Println(tcase.tf.User(userID))
 			log.Println(tcase.Input.User)
 
 			user, _ := tcase.tf.User(userID)
@@ -209,3 +217,540 @@ func TestCommandSell(t *testing.T) {
 		})
 	}
 }
+
+func TestCommandFilter(t *testing.T) {
+	testTable := []struct {
+		Name                 string
+		Args                 string
+		User                 User
+		ExpectedFilter       string
+		ExpectedPolling      bool
+		ExpectedRepliesRegex *regexp.Regexp
+	}{
+		{
+			Name:                 "Shows usage without a filter",
+			ExpectedRepliesRegex: regexp.MustCompile(`Usage: .*`),
+		}, {
+			Name:                 "Shows the current filter",
+			User:                 User{FilterExpr: "price > 500"},
+			ExpectedFilter:       "price > 500",
+			ExpectedRepliesRegex: regexp.MustCompile(`Your filter is: price > 500`),
+		}, {
+			Name:                 "Saves a valid filter and enables polling",
+			Args:                 "price >= 450 && fee == 0",
+			ExpectedFilter:       "price >= 450 && fee == 0",
+			ExpectedPolling:      true,
+			ExpectedRepliesRegex: regexp.MustCompile(`matching: price >= 450 && fee == 0`),
+		}, {
+			Name:                 "Replies with the parse error for an invalid filter",
+			Args:                 "price >= ",
+			User:                 User{FilterExpr: "price > 500"},
+			ExpectedFilter:       "price > 500",
+			ExpectedRepliesRegex: regexp.MustCompile(`Could not use that filter: .*end of the filter.*character 9`),
+		}, {
+			Name:                 "Clears the filter",
+			Args:                 "clear",
+			User:                 User{FilterExpr: "price > 500"},
+			ExpectedRepliesRegex: regexp.MustCompile(`cleared`),
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			tf := New()
+			tf.RegisterDefaultCommands()
+			tcase.User.ID = "foo"
+			tf.SetUser(tcase.User)
+
+			mock, reply := mockReply(false)
+			err := tf.RunCommand(ChatCommandInput{Name: "filter", Args: tcase.Args, User: tcase.User, Reply: reply})
+			if err != nil {
+				t.Errorf("Expected error to be nil but received %v", err)
+			}
+
+			user, _ := tf.User("foo")
+			if user.FilterExpr != tcase.ExpectedFilter {
+				t.Errorf("Expected user's filter to be %q but found %q", tcase.ExpectedFilter, user.FilterExpr)
+			}
+			if user.Polling != tcase.ExpectedPolling {
+				t.Errorf("Expected user's polling to be %t but found %t", tcase.ExpectedPolling, user.Polling)
+			}
+
+			if len(mock.Got) != 1 {
+				t.Fatalf("Expected 1 reply but received %d", len(mock.Got))
+			}
+			if !tcase.ExpectedRepliesRegex.MatchString(mock.Got[0]) {
+				t.Errorf("Expected reply to match /%s/ but received %q", tcase.ExpectedRepliesRegex.String(), mock.Got[0])
+			}
+		})
+	}
+}
+
+func TestCommandFormat(t *testing.T) {
+	testTable := []struct {
+		Name                 string
+		Args                 string
+		User                 User
+		ExpectedFormat       string
+		ExpectedRepliesRegex *regexp.Regexp
+	}{
+		{
+			Name:                 "Shows the default format and presets",
+			ExpectedRepliesRegex: regexp.MustCompile(`Your format is: full\nPresets: compact, full, mobile`),
+		}, {
+			Name:                 "Sets a preset ignoring case",
+			Args:                 "Mobile",
+			ExpectedFormat:       FormatMobile,
+			ExpectedRepliesRegex: regexp.MustCompile(`sent to you as: mobile`),
+		}, {
+			Name:                 "Saves a valid custom template",
+			Args:                 "{{.Price}} bells at {{.Name}}",
+			ExpectedFormat:       "{{.Price}} bells at {{.Name}}",
+			ExpectedRepliesRegex: regexp.MustCompile(`sent to you as: \{\{.Price\}\} bells`),
+		}, {
+			Name:                 "Rejects invalid templates without saving them",
+			Args:                 "{{.Secret}}",
+			User:                 User{Format: FormatCompact},
+			ExpectedFormat:       FormatCompact,
+			ExpectedRepliesRegex: regexp.MustCompile(`Could not use that format: .*Secret`),
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			tf := New()
+			tf.RegisterDefaultCommands()
+			tcase.User.ID = "foo"
+			tf.SetUser(tcase.User)
+
+			mock, reply := mockReply(false)
+			err := tf.RunCommand(ChatCommandInput{Name: "format", Args: tcase.Args, User: tcase.User, Reply: reply})
+			if err != nil {
+				t.Errorf("Expected error to be nil but received %v", err)
+			}
+
+			user, _ := tf.User("foo")
+			if user.Format != tcase.ExpectedFormat {
+				t.Errorf("Expected user's format to be %q but found %q", tcase.ExpectedFormat, user.Format)
+			}
+
+			if len(mock.Got) != 1 {
+				t.Fatalf("Expected 1 reply but received %d", len(mock.Got))
+			}
+			if !tcase.ExpectedRepliesRegex.MatchString(mock.Got[0]) {
+				t.Errorf("Expected reply to match /%s/ but received %q", tcase.ExpectedRepliesRegex.String(), mock.Got[0])
+			}
+		})
+	}
+}
+
+func TestCommandDeliver(t *testing.T) {
+	emailTarget := NotifyTarget{Notifier: NotifierEmail, Recipient: "me@example.com"}
+	discordTarget := NotifyTarget{Notifier: NotifierDiscord, Recipient: "foo"}
+
+	testTable := []struct {
+		Name                 string
+		Args                 string
+		NotifyVia            []NotifyTarget
+		ExpectedNotifyVia    []NotifyTarget
+		ExpectedRepliesRegex *regexp.Regexp
+	}{
+		{
+			Name:                 "Lists the default notifier",
+			Args:                 "list",
+			ExpectedRepliesRegex: regexp.MustCompile(`sent to you by:\ndiscord: foo$`),
+		}, {
+			Name:                 "Adds a notifier keeping the default",
+			Args:                 "add webhook https://203.0.113.7/hook",
+			ExpectedNotifyVia:    []NotifyTarget{discordTarget, {Notifier: NotifierWebhook, Recipient: "https://203.0.113.7/hook"}},
+			ExpectedRepliesRegex: regexp.MustCompile(`sent to you by discord, webhook`),
+		}, {
+			Name:                 "Asks to confirm email addresses",
+			Args:                 "add email me@example.com",
+			ExpectedRepliesRegex: regexp.MustCompile(`Sent a confirmation code to me@example.com`),
+		}, {
+			Name:                 "Always sends the default notifier to the user",
+			Args:                 "add discord someone-else",
+			NotifyVia:            []NotifyTarget{emailTarget},
+			ExpectedNotifyVia:    []NotifyTarget{emailTarget, discordTarget},
+			ExpectedRepliesRegex: regexp.MustCompile(`sent to you by email, discord`),
+		}, {
+			Name:                 "Rejects invalid recipients",
+			Args:                 "add webhook http://127.0.0.1/hook",
+			ExpectedRepliesRegex: regexp.MustCompile(`Could not use that recipient: .*local addresses`),
+		}, {
+			Name:                 "Rejects unknown notifiers",
+			Args:                 "add pigeon coop",
+			ExpectedRepliesRegex: regexp.MustCompile(`no notifier named pigeon. Choose from discord, email, webhook`),
+		}, {
+			Name:                 "Removes a notifier",
+			Args:                 "remove discord",
+			NotifyVia:            []NotifyTarget{discordTarget, emailTarget},
+			ExpectedNotifyVia:    []NotifyTarget{emailTarget},
+			ExpectedRepliesRegex: regexp.MustCompile(`sent to you by email$`),
+		}, {
+			Name:                 "Keeps the last notifier",
+			Args:                 "remove discord",
+			ExpectedRepliesRegex: regexp.MustCompile(`at least one notifier`),
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			tf := New()
+			tf.RegisterDefaultCommands()
+			tf.AddNotifier(NotifierDiscord, newMockNotifier(NotifierCapabilities{Embeds: true}, nil))
+			tf.AddNotifier(NotifierEmail, &confirmingNotifier{mockNotifier: newMockNotifier(NotifierCapabilities{}, nil)})
+			tf.AddNotifier(NotifierWebhook, NewWebhookNotifier())
+			tf.DefaultNotifier = NotifierDiscord
+			user := User{ID: "foo", MaxInQueue: -1, NotifyVia: tcase.NotifyVia}
+			tf.SetUser(user)
+
+			mock, reply := mockReply(false)
+			err := tf.RunCommand(ChatCommandInput{Name: "deliver", Args: tcase.Args, User: user, Reply: reply})
+			if err != nil {
+				t.Errorf("Expected error to be nil but received %v", err)
+			}
+
+			user, _ = tf.User("foo")
+			expected := tcase.ExpectedNotifyVia
+			if expected == nil {
+				expected = tcase.NotifyVia
+			}
+			if !reflect.DeepEqual(user.NotifyVia, expected) {
+				t.Errorf("Expected notifiers %v but found %v", expected, user.NotifyVia)
+			}
+
+			if len(mock.Got) != 1 {
+				t.Fatalf("Expected 1 reply but received %d", len(mock.Got))
+			}
+			if !tcase.ExpectedRepliesRegex.MatchString(mock.Got[0]) {
+				t.Errorf("Expected reply to match /%s/ but received %q", tcase.ExpectedRepliesRegex.String(), mock.Got[0])
+			}
+		})
+	}
+}
+
+// confirmingNotifier records the confirmation codes it sends.
+type confirmingNotifier struct {
+	*mockNotifier
+	codes []string
+}
+
+func (n *confirmingNotifier) SendConfirmation(ctx context.Context, recipient string, code string) error {
+	n.codes = append(n.codes, code)
+	return nil
+}
+
+func TestCommandDeliverConfirm(t *testing.T) {
+	clock := newTestClock(time.Date(2020, 4, 18, 12, 0, 0, 0, time.UTC))
+	tf := New()
+	tf.Clock = clock
+	tf.RegisterDefaultCommands()
+	email := &confirmingNotifier{mockNotifier: newMockNotifier(NotifierCapabilities{}, nil)}
+	tf.AddNotifier(NotifierDiscord, newMockNotifier(NotifierCapabilities{}, nil))
+	tf.AddNotifier(NotifierEmail, email)
+	tf.DefaultNotifier = NotifierDiscord
+	tf.SetUser(User{ID: "foo", MaxInQueue: -1})
+
+	deliver := func(args string) string {
+		user, _ := tf.User("foo")
+		mock, reply := mockReply(false)
+		err := tf.RunCommand(ChatCommandInput{Name: "deliver", Args: args, User: user, Reply: reply})
+		if err != nil || len(mock.Got) != 1 {
+			t.Fatalf("Expected 1 reply but received %q, %v", mock.Got, err)
+		}
+		return mock.Got[0]
+	}
+
+	deliver("add email me@example.com")
+	if len(email.codes) != 1 {
+		t.Fatalf("Expected a confirmation code to be sent but received %d", len(email.codes))
+	}
+	if reply := deliver("add email other@example.com"); !strings.HasPrefix(reply, "A confirmation code was sent recently") {
+		t.Errorf("Expected a second code to be refused but received %q", reply)
+	}
+	if reply := deliver("confirm email 1234567"); reply != "That code is wrong" {
+		t.Errorf("Expected a wrong code to be refused but received %q", reply)
+	}
+
+	deliver("confirm email " + email.codes[0])
+	user, _ := tf.User("foo")
+	expected := []NotifyTarget{{Notifier: NotifierDiscord, Recipient: "foo"}, {Notifier: NotifierEmail, Recipient: "me@example.com"}}
+	if !reflect.DeepEqual(user.NotifyVia, expected) {
+		t.Errorf("Expected notifiers %v but found %v", expected, user.NotifyVia)
+	}
+	if reply := deliver("confirm email " + email.codes[0]); !strings.HasPrefix(reply, "There is no email waiting") {
+		t.Errorf("Expected the code to only work once but received %q", reply)
+	}
+
+	clock.Advance(confirmationResend)
+	deliver("add email other@example.com")
+	clock.Advance(confirmationExpiry + time.Minute)
+	if reply := deliver("confirm email " + email.codes[1]); !strings.HasPrefix(reply, "There is no email waiting") {
+		t.Errorf("Expected the code to expire but received %q", reply)
+	}
+}
+
+func TestCommandWatch(t *testing.T) {
+	existing := []Watch{{Name: "sell-high", Expr: "price>=550", Listing: ListingSell}}
+
+	testTable := []struct {
+		Name                 string
+		Args                 string
+		Watches              []Watch
+		ExpectedWatches      []Watch
+		ExpectedRepliesRegex *regexp.Regexp
+	}{
+		{
+			Name:                 "Shows usage without arguments",
+			ExpectedRepliesRegex: regexp.MustCompile(`Usage: !watch`),
+		}, {
+			Name:                 "Adds a watch with options",
+			Args:                 "add Cheap buy compact price < 95",
+			ExpectedWatches:      []Watch{{Name: "cheap", Expr: "price < 95", Listing: ListingBuy, Style: FormatCompact}},
+			ExpectedRepliesRegex: regexp.MustCompile(`Added watch cheap \(buy, compact\): price < 95`),
+		}, {
+			Name:                 "Replaces a watch with the same name",
+			Args:                 "add sell-high price>=600 queue<10",
+			Watches:              existing,
+			ExpectedWatches:      []Watch{{Name: "sell-high", Expr: "price>=600 queue<10", Listing: ListingSell}},
+			ExpectedRepliesRegex: regexp.MustCompile(`Updated watch sell-high`),
+		}, {
+			Name:                 "Rejects invalid expressions",
+			Args:                 "add broken price >=",
+			ExpectedRepliesRegex: regexp.MustCompile(`Could not use that filter`),
+		}, {
+			Name:                 "Rejects invalid names",
+			Args:                 "add sell!high price > 500",
+			ExpectedRepliesRegex: regexp.MustCompile(`Watch names may only use`),
+		}, {
+			Name:                 "Lists watches",
+			Args:                 "list",
+			Watches:              existing,
+			ExpectedWatches:      existing,
+			ExpectedRepliesRegex: regexp.MustCompile(`sell-high \(sell\): price>=550`),
+		}, {
+			Name:                 "Pauses a watch",
+			Args:                 "pause sell-high",
+			Watches:              existing,
+			ExpectedWatches:      []Watch{{Name: "sell-high", Expr: "price>=550", Listing: ListingSell, Paused: true}},
+			ExpectedRepliesRegex: regexp.MustCompile(`Paused watch sell-high`),
+		}, {
+			Name:                 "Removes a watch",
+			Args:                 "remove sell-high",
+			Watches:              existing,
+			ExpectedWatches:      []Watch{},
+			ExpectedRepliesRegex: regexp.MustCompile(`Removed watch sell-high`),
+		}, {
+			Name:                 "Reports missing watches",
+			Args:                 "remove nope",
+			ExpectedRepliesRegex: regexp.MustCompile(`no watch named nope`),
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			tf := New()
+			tf.RegisterDefaultCommands()
+			user := User{ID: "foo", MaxInQueue: -1, Watches: tcase.Watches}
+			tf.SetUser(user)
+			user, _ = tf.User("foo")
+
+			mock, reply := mockReply(false)
+			err := tf.RunCommand(ChatCommandInput{Name: "watch", Args: tcase.Args, User: user, Reply: reply})
+			if err != nil {
+				t.Errorf("Expected error to be nil but received %v", err)
+			}
+
+			user, _ = tf.User("foo")
+			if len(user.Watches) != len(tcase.ExpectedWatches) {
+				t.Fatalf("Expected %d watches but found %d", len(tcase.ExpectedWatches), len(user.Watches))
+			}
+			for idx, watch := range tcase.ExpectedWatches {
+				if user.Watches[idx] != watch {
+					t.Errorf("Expected watch %+v but found %+v", watch, user.Watches[idx])
+				}
+			}
+
+			if len(mock.Got) != 1 {
+				t.Fatalf("Expected 1 reply but received %d", len(mock.Got))
+			}
+			if !tcase.ExpectedRepliesRegex.MatchString(mock.Got[0]) {
+				t.Errorf("Expected reply to match /%s/ but received %q", tcase.ExpectedRepliesRegex.String(), mock.Got[0])
+			}
+		})
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	testTable := []struct {
+		Name                 string
+		Command              string
+		ExpectedPanicError   bool
+		ExpectedRepliesRegex *regexp.Regexp
+	}{
+		{
+			Name:                 "Runs known commands",
+			Command:              "echo",
+			ExpectedRepliesRegex: regexp.MustCompile(`^hello$`),
+		}, {
+			Name:                 "Suggests close commands",
+			Command:              "sel",
+			ExpectedRepliesRegex: regexp.MustCompile(`Unknown command !sel\. Did you mean !sell\?`),
+		}, {
+			Name:                 "Suggests every command tied for nearest",
+			Command:              "se",
+			ExpectedRepliesRegex: regexp.MustCompile(`Did you mean !fee or !sell\?`),
+		}, {
+			Name:                 "Points to help without close commands",
+			Command:              "turnips",
+			ExpectedRepliesRegex: regexp.MustCompile(`Unknown command !turnips\. Send !help`),
+		}, {
+			Name:                 "Recovers from panicking commands",
+			Command:              "panic",
+			ExpectedPanicError:   true,
+			ExpectedRepliesRegex: regexp.MustCompile(`something went wrong running !panic`),
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			tf := New()
+			tf.RegisterDefaultCommands()
+			tf.AddCommand("panic", func(tf *TurnipFinder, input ChatCommandInput) error {
+				panic("boom")
+			})
+
+			mock, reply := mockReply(false)
+			err := tf.RunCommand(ChatCommandInput{Name: tcase.Command, Args: "hello", User: User{ID: "foo"}, Reply: reply})
+
+			var panicErr *ErrorCommandPanic
+			if errors.As(err, &panicErr) != tcase.ExpectedPanicError {
+				t.Errorf("Expected panic error to be %t but received %v", tcase.ExpectedPanicError, err)
+			} else if !tcase.ExpectedPanicError && err != nil {
+				t.Errorf("Expected error to be nil but received %v", err)
+			}
+
+			if len(mock.Got) != 1 {
+				t.Fatalf("Expected 1 reply but received %d", len(mock.Got))
+			}
+			if !tcase.ExpectedRepliesRegex.MatchString(mock.Got[0]) {
+				t.Errorf("Expected reply to match /%s/ but received %q", tcase.ExpectedRepliesRegex.String(), mock.Got[0])
+			}
+		})
+	}
+}
+
+func TestCommandChannel(t *testing.T) {
+	testTable := []struct {
+		Name                 string
+		Args                 string
+		GuildID              string
+		Admin                bool
+		Channel              *Channel
+		ExpectedChannel      *Channel
+		ExpectedRepliesRegex *regexp.Regexp
+	}{
+		{
+			Name:                 "Only works in server channels",
+			Args:                 "watch sell 500",
+			Admin:                true,
+			ExpectedRepliesRegex: regexp.MustCompile(`in the server channel`),
+		}, {
+			Name:                 "Only works for admins",
+			Args:                 "watch sell 500",
+			GuildID:              "guild",
+			ExpectedRepliesRegex: regexp.MustCompile(`Only server admins`),
+		}, {
+			Name:                 "Watches sell prices",
+			Args:                 "watch sell 500",
+			GuildID:              "guild",
+			Admin:                true,
+			ExpectedChannel:      &Channel{SellPrice: 500},
+			ExpectedRepliesRegex: regexp.MustCompile(`turnip price over 500`),
+		}, {
+			Name:                 "Watches buy prices",
+			Args:                 "watch BUY 95",
+			GuildID:              "guild",
+			Admin:                true,
+			Channel:              &Channel{SellPrice: 500},
+			ExpectedChannel:      &Channel{SellPrice: 500, BuyPrice: 95},
+			ExpectedRepliesRegex: regexp.MustCompile(`over 500 and with Daisy Mae selling turnips under 95`),
+		}, {
+			Name:                 "Shows usage for invalid watches",
+			Args:                 "watch 500",
+			GuildID:              "guild",
+			Admin:                true,
+			ExpectedRepliesRegex: regexp.MustCompile(`Usage: !channel`),
+		}, {
+			Name:                 "Mentions a role",
+			Args:                 "mention <@&42>",
+			GuildID:              "guild",
+			Admin:                true,
+			Channel:              &Channel{SellPrice: 500},
+			ExpectedChannel:      &Channel{SellPrice: 500, MentionRoleID: "42"},
+			ExpectedRepliesRegex: regexp.MustCompile(`mentioning <@&42>`),
+		}, {
+			Name:                 "Stops the channel",
+			Args:                 "stop",
+			GuildID:              "guild",
+			Admin:                true,
+			Channel:              &Channel{SellPrice: 500},
+			ExpectedRepliesRegex: regexp.MustCompile(`stopped looking`),
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			tf := New()
+			tf.RegisterDefaultCommands()
+			if tcase.Channel != nil {
+				channel := NewChannel("turnips", "guild")
+				channel.SellPrice = tcase.Channel.SellPrice
+				tf.SetChannel(channel)
+			}
+
+			mock, reply := mockReply(false)
+			err := tf.RunCommand(ChatCommandInput{Name: "channel", Args: tcase.Args, User: User{ID: "foo"}, ChannelID: "turnips", GuildID: tcase.GuildID, Admin: tcase.Admin, Reply: reply})
+			if err != nil {
+				t.Errorf("Expected error to be nil but received %v", err)
+			}
+
+			channel, err := tf.Channel("turnips")
+			if tcase.ExpectedChannel == nil {
+				if err == nil && tcase.Channel == nil {
+					t.Errorf("Expected no channel but found %+v", channel)
+				}
+			} else if channel.SellPrice != tcase.ExpectedChannel.SellPrice || channel.BuyPrice != tcase.ExpectedChannel.BuyPrice || channel.MentionRoleID != tcase.ExpectedChannel.MentionRoleID {
+				t.Errorf("Expected channel %+v but found %+v", *tcase.ExpectedChannel, channel)
+			}
+
+			if len(mock.Got) != 1 {
+				t.Fatalf("Expected 1 reply but received %d", len(mock.Got))
+			}
+			if !tcase.ExpectedRepliesRegex.MatchString(mock.Got[0]) {
+				t.Errorf("Expected reply to match /%s/ but received %q", tcase.ExpectedRepliesRegex.String(), mock.Got[0])
+			}
+		})
+	}
+}
+
+func TestCommandSources(t *testing.T) {
+	tf := New()
+	tf.RegisterDefaultCommands()
+	tf.AddSource(&staticSource{islands: testIslands(2)})
+	tf.AddSource(&failingSource{errs: []error{&ErrorSourceFatal{Err: errors.New("gone")}}})
+	tf.PollSources(WithSourceQuery(context.Background(), SourceQuery{}))
+
+	mock, reply := mockReply(false)
+	err := tf.RunCommand(ChatCommandInput{Name: "sources", User: User{ID: "foo"}, Reply: reply})
+	if err != nil {
+		t.Fatalf("Expected error to be nil but received %v", err)
+	}
+
+	expected := regexp.MustCompile(`^Static: 1 runs, 0 failures, 0 retries, 0 skipped, 0 rate limited, last took \S+\nFailing: 1 runs, 1 failures, 0 retries, 0 skipped, 0 rate limited, last took \S+, last error: Fatal source error: gone, disabled$`)
+	if len(mock.Got) != 1 || !expected.MatchString(mock.Got[0]) {
+		t.Errorf("Expected stats for both sources but received %q", mock.Got)
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type CommandArgType int
+
+const (
+	// CommandArgWord is a single word.
+	CommandArgWord CommandArgType = iota
+	// CommandArgInt is a single whole number.
+	CommandArgInt
+	// CommandArgText is the rest of the message and must be the last argument.
+	CommandArgText
+)
+
+// CommandArg describes one argument of a command. Choices limit a word to a
+// set of values, ignoring case. A repeated argument takes every remaining word
+// and must be the last argument. Complete suggests values for a partly typed
+// argument; arguments with choices are completed from them without it.
+type CommandArg struct {
+	Name        string
+	Description string
+	Type        CommandArgType
+	Optional    bool
+	Repeated    bool
+	Choices     []string
+	Complete    func(tf *TurnipFinder, user User, prefix string) []string
+}
+
+func (a CommandArg) String() string {
+	name := a.Name
+	if len(a.Choices) > 0 {
+		name = strings.Join(a.Choices, "|")
+	}
+	if a.Repeated || a.Type == CommandArgText {
+		name += "..."
+	}
+
+	if a.Optional {
+		return fmt.Sprintf("[%s]", name)
+	}
+
+	return fmt.Sprintf("<%s>", name)
+}
+
+// Command is a chat command with the metadata used to parse its arguments and
+// build its help. Commands without Args receive the message unparsed.
+type Command struct {
+	Name        string
+	Aliases     []string
+	Description string
+	Args        []CommandArg
+	Examples    []string
+	Run         ChatCommand
+}
+
+// Usage returns the command's usage line, for example !sell <price>.
+func (c Command) Usage() string {
+	parts := []string{"!" + c.Name}
+	for _, arg := range c.Args {
+		parts = append(parts, arg.String())
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Help returns the detailed help for the command.
+func (c Command) Help() string {
+	lines := []string{fmt.Sprintf("Usage: %s", c.Usage())}
+	if c.Description != "" {
+		lines = append(lines, c.Description)
+	}
+	if len(c.Aliases) > 0 {
+		aliases := make([]string, 0, len(c.Aliases))
+		for _, alias := range c.Aliases {
+			aliases = append(aliases, "!"+alias)
+		}
+		lines = append(lines, fmt.Sprintf("Aliases: %s", strings.Join(aliases, ", ")))
+	}
+	for _, arg := range c.Args {
+		if arg.Description != "" {
+			lines = append(lines, fmt.Sprintf("  %s: %s", arg.Name, arg.Description))
+		}
+	}
+	if len(c.Examples) > 0 {
+		lines = append(lines, "Examples:")
+		for _, example := range c.Examples {
+			lines = append(lines, "  "+example)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// CommandValues holds parsed arguments by name. Ints are stored as int,
+// repeated arguments as []string and everything else as string.
+type CommandValues map[string]interface{}
+
+type ErrorCommandUsage struct {
+	Usage   string
+	Message string
+}
+
+func (e *ErrorCommandUsage) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("Usage: %s", e.Usage)
+	}
+
+	return fmt.Sprintf("%s\nUsage: %s", e.Message, e.Usage)
+}
+
+// ParseArgs parses args against the command's argument specs.
+func (c Command) ParseArgs(args string) (CommandValues, error) {
+	values := make(CommandValues)
+	rest := strings.TrimSpace(args)
+
+	for _, arg := range c.Args {
+		if rest == "" {
+			if !arg.Optional {
+				return nil, &ErrorCommandUsage{Usage: c.Usage(), Message: fmt.Sprintf("Missing %s", arg.Name)}
+			}
+			continue
+		}
+
+		switch {
+		case arg.Type == CommandArgText:
+			values[arg.Name] = rest
+			rest = ""
+		case arg.Repeated:
+			words, err := c.parseWords(arg, rest)
+			if err != nil {
+				return nil, err
+			}
+			values[arg.Name] = words
+			rest = ""
+		default:
+			var word string
+			word, rest = cutWord(rest)
+
+			value, err := c.parseWord(arg, word)
+			if err != nil {
+				return nil, err
+			}
+			values[arg.Name] = value
+		}
+	}
+
+	if rest != "" && c.Args != nil {
+		return nil, &ErrorCommandUsage{Usage: c.Usage(), Message: fmt.Sprintf("Unexpected %q", rest)}
+	}
+
+	return values, nil
+}
+
+// ParseOptions parses arguments given by name, as slash commands give them,
+// so leaving out an optional argument does not shift the ones after it.
+func (c Command) ParseOptions(options map[string]string) (CommandValues, error) {
+	values := make(CommandValues)
+	known := make(map[string]bool, len(c.Args))
+
+	for _, arg := range c.Args {
+		known[arg.Name] = true
+		option := strings.TrimSpace(options[arg.Name])
+		if option == "" {
+			if !arg.Optional {
+				return nil, &ErrorCommandUsage{Usage: c.Usage(), Message: fmt.Sprintf("Missing %s", arg.Name)}
+			}
+			continue
+		}
+
+		switch {
+		case arg.Type == CommandArgText:
+			values[arg.Name] = option
+		case arg.Repeated:
+			words, err := c.parseWords(arg, option)
+			if err != nil {
+				return nil, err
+			}
+			values[arg.Name] = words
+		default:
+			if word, rest := cutWord(option); rest != "" {
+				return nil, &ErrorCommandUsage{Usage: c.Usage(), Message: fmt.Sprintf("%s must be a single word, not %q", arg.Name, word+" "+rest)}
+			}
+
+			value, err := c.parseWord(arg, option)
+			if err != nil {
+				return nil, err
+			}
+			values[arg.Name] = value
+		}
+	}
+
+	for name := range options {
+		if !known[name] {
+			return nil, &ErrorCommandUsage{Usage: c.Usage(), Message: fmt.Sprintf("Unexpected %s", name)}
+		}
+	}
+
+	return values, nil
+}
+
+func (c Command) parseWords(arg CommandArg, text string) ([]string, error) {
+	words := strings.Fields(text)
+	for idx, word := range words {
+		value, err := c.parseWord(arg, word)
+		if err != nil {
+			return nil, err
+		}
+		words[idx] = value.(string)
+	}
+
+	return words, nil
+}
+
+func (c Command) parseWord(arg CommandArg, word string) (interface{}, error) {
+	if arg.Type == CommandArgInt {
+		value, err := strconv.Atoi(word)
+		if err != nil {
+			return nil, &ErrorCommandUsage{Usage: c.Usage(), Message: fmt.Sprintf("%s must be a number", arg.Name)}
+		}
+
+		return value, nil
+	}
+
+	if len(arg.Choices) > 0 {
+		for _, choice := range arg.Choices {
+			if strings.EqualFold(word, choice) {
+				return choice, nil
+			}
+		}
+
+		return nil, &ErrorCommandUsage{Usage: c.Usage(), Message: fmt.Sprintf("%s must be one of %s", arg.Name, strings.Join(arg.Choices, ", "))}
+	}
+
+	return word, nil
+}
+
+// cutWord splits the first word from s and returns the rest with leading
+// space removed, leaving spacing inside the rest untouched.
+func cutWord(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	idx := strings.IndexAny(s, " \t\n")
+	if idx < 0 {
+		return s, ""
+	}
+
+	return s[:idx], strings.TrimSpace(s[idx:])
+}
+
+// Has reports whether the argument was given.
+func (input ChatCommandInput) Has(name string) bool {
+	_, ok := input.Values[name]
+	return ok
+}
+
+// Int returns an int argument, or 0 if it was not given.
+func (input ChatCommandInput) Int(name string) int {
+	value, _ := input.Values[name].(int)
+	return value
+}
+
+// String returns a word or text argument, or "" if it was not given.
+func (input ChatCommandInput) String(name string) string {
+	value, _ := input.Values[name].(string)
+	return value
+}
+
+// Strings returns a repeated argument.
+func (input ChatCommandInput) Strings(name string) []string {
+	value, _ := input.Values[name].([]string)
+	return value
+}
+
+// ReplyUsage replies with a problem followed by the command's usage.
+func (input ChatCommandInput) ReplyUsage(message string) error {
+	return input.Reply((&ErrorCommandUsage{Usage: input.Command.Usage(), Message: message}).Error())
+}
+
+// CompleteArg suggests values for an argument starting with prefix. Repeated
+// arguments complete their last word and keep the words before it.
+func (tf *TurnipFinder) CompleteArg(user User, arg CommandArg, prefix string) []string {
+	if arg.Complete != nil {
+		return arg.Complete(tf, user, prefix)
+	}
+
+	before := ""
+	if arg.Repeated {
+		if idx := strings.LastIndexAny(prefix, " \t"); idx >= 0 {
+			before, prefix = prefix[:idx+1], prefix[idx+1:]
+		}
+	}
+
+	return completeWords(arg.Choices, prefix, before)
+}
+
+func completeWords(words []string, prefix string, before string) []string {
+	completions := make([]string, 0)
+	for _, word := range words {
+		if strings.HasPrefix(strings.ToLower(word), strings.ToLower(prefix)) {
+			completions = append(completions, before+word)
+		}
+	}
+
+	return completions
+}
+
+func completeCommandNames(tf *TurnipFinder, user User, prefix string) []string {
+	return completeWords(tf.CommandNames(), strings.TrimPrefix(prefix, "!"), "")
+}
+
+func completeWatchNames(tf *TurnipFinder, user User, prefix string) []string {
+	names := make([]string, 0, len(user.Watches))
+	for _, watch := range user.Watches {
+		names = append(names, watch.Name)
+	}
+
+	return completeWords(names, prefix, "")
+}
+
+func completeNotifierNames(tf *TurnipFinder, user User, prefix string) []string {
+	return completeWords(tf.NotifierNames(), prefix, "")
+}
+
+func sortedCommands(commands map[string]Command) []Command {
+	sorted := make([]Command, 0, len(commands))
+	for _, command := range commands {
+		sorted = append(sorted, command)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	return sorted
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestCommandParseArgs(t *testing.T) {
+	cmd := Command{
+		Name: "test",
+		Args: []CommandArg{
+			{Name: "count", Type: CommandArgInt},
+			{Name: "mode", Choices: []string{"fast", "slow"}, Optional: true},
+			{Name: "text", Type: CommandArgText, Optional: true},
+		},
+	}
+
+	testTable := []struct {
+		Name           string
+		Args           string
+		ExpectedValues CommandValues
+		ExpectedError  *regexp.Regexp
+	}{
+		{
+			Name:           "Parses every argument",
+			Args:           " 5 FAST price >  5  ",
+			ExpectedValues: CommandValues{"count": 5, "mode": "fast", "text": "price >  5"},
+		}, {
+			Name:           "Leaves out optional arguments",
+			Args:           "5",
+			ExpectedValues: CommandValues{"count": 5},
+		}, {
+			Name:          "Reports missing arguments",
+			ExpectedError: regexp.MustCompile(`^Missing count\nUsage: !test <count> \[fast\|slow\] \[text\.\.\.\]$`),
+		}, {
+			Name:          "Reports invalid numbers",
+			Args:          "five",
+			ExpectedError: regexp.MustCompile(`^count must be a number\nUsage: `),
+		}, {
+			Name:          "Reports invalid choices",
+			Args:          "5 medium",
+			ExpectedError: regexp.MustCompile(`^mode must be one of fast, slow\nUsage: `),
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			values, err := cmd.ParseArgs(tcase.Args)
+			if tcase.ExpectedError != nil {
+				if err == nil || !tcase.ExpectedError.MatchString(err.Error()) {
+					t.Errorf("Expected error to match /%s/ but received %v", tcase.ExpectedError.String(), err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("Expected error to be nil but received %v", err)
+			}
+
+			if !reflect.DeepEqual(values, tcase.ExpectedValues) {
+				t.Errorf("Expected values %v but received %v", tcase.ExpectedValues, values)
+			}
+		})
+	}
+}
+
+func TestCommandParseOptions(t *testing.T) {
+	cmd := Command{
+		Name: "test",
+		Args: []CommandArg{
+			{Name: "action", Choices: []string{"add", "list"}},
+			{Name: "name", Optional: true},
+			{Name: "expression", Type: CommandArgText, Optional: true},
+		},
+	}
+
+	testTable := []struct {
+		Name           string
+		Options        map[string]string
+		ExpectedValues CommandValues
+		ExpectedError  *regexp.Regexp
+	}{
+		{
+			Name:           "Parses every option",
+			Options:        map[string]string{"expression": "price > 500", "action": "ADD", "name": "high"},
+			ExpectedValues: CommandValues{"action": "add", "name": "high", "expression": "price > 500"},
+		}, {
+			Name:           "Leaving out an option does not shift the others",
+			Options:        map[string]string{"action": "add", "expression": "price>500"},
+			ExpectedValues: CommandValues{"action": "add", "expression": "price>500"},
+		}, {
+			Name:          "Reports missing options",
+			Options:       map[string]string{"name": "high"},
+			ExpectedError: regexp.MustCompile(`^Missing action\nUsage: `),
+		}, {
+			Name:          "Reports several words for a word option",
+			Options:       map[string]string{"action": "add", "name": "very high"},
+			ExpectedError: regexp.MustCompile(`^name must be a single word`),
+		}, {
+			Name:          "Reports unknown options",
+			Options:       map[string]string{"action": "add", "colour": "red"},
+			ExpectedError: regexp.MustCompile(`^Unexpected colour\nUsage: `),
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			values, err := cmd.ParseOptions(tcase.Options)
+			if tcase.ExpectedError != nil {
+				if err == nil || !tcase.ExpectedError.MatchString(err.Error()) {
+					t.Errorf("Expected error to match /%s/ but received %v", tcase.ExpectedError.String(), err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("Expected error to be nil but received %v", err)
+			}
+
+			if !reflect.DeepEqual(values, tcase.ExpectedValues) {
+				t.Errorf("Expected values %v but received %v", tcase.ExpectedValues, values)
+			}
+		})
+	}
+}
+
+func TestCommandHelp(t *testing.T) {
+	testTable := []struct {
+		Name                 string
+		Command              string
+		Args                 string
+		ExpectedRepliesRegex *regexp.Regexp
+	}{
+		{
+			Name:                 "Lists commands sorted by name",
+			Command:              "help",
+			ExpectedRepliesRegex: regexp.MustCompile(`(?s)^Commands:\n!buy <price> - .*\n!echo .*\n!fee .*!watch <add\|list\|remove\|pause\|resume> .*\nSend !help <command> for details\.$`),
+		}, {
+			Name:                 "Explains one command",
+			Command:              "help",
+			Args:                 "!maxqueue",
+			ExpectedRepliesRegex: regexp.MustCompile(`(?s)^Usage: !maxqueue <size>\n.*\nAliases: !queue\nExamples:\n  !maxqueue 10$`),
+		}, {
+			Name:                 "Finds commands by alias",
+			Command:              "commands",
+			Args:                 "queue",
+			ExpectedRepliesRegex: regexp.MustCompile(`^Usage: !maxqueue <size>`),
+		}, {
+			Name:                 "Reports unknown commands",
+			Command:              "help",
+			Args:                 "sel",
+			ExpectedRepliesRegex: regexp.MustCompile(`Did you mean !sell\?`),
+		}, {
+			Name:                 "Replies with usage for invalid arguments",
+			Command:              "history",
+			Args:                 "lots",
+			ExpectedRepliesRegex: regexp.MustCompile(`^count must be a number\nUsage: !history \[count\]$`),
+		}, {
+			Name:                 "Replies with usage for extra arguments",
+			Command:              "stop",
+			Args:                 "now",
+			ExpectedRepliesRegex: regexp.MustCompile(`^Unexpected "now"\nUsage: !stop$`),
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			tf := New()
+			tf.RegisterDefaultCommands()
+
+			mock, reply := mockReply(false)
+			err := tf.RunCommand(ChatCommandInput{Name: tcase.Command, Args: tcase.Args, User: User{ID: "foo"}, Reply: reply})
+			if err != nil {
+				t.Errorf("Expected error to be nil but received %v", err)
+			}
+
+			if len(mock.Got) != 1 {
+				t.Fatalf("Expected 1 reply but received %d", len(mock.Got))
+			}
+			if !tcase.ExpectedRepliesRegex.MatchString(mock.Got[0]) {
+				t.Errorf("Expected reply to match /%s/ but received %q", tcase.ExpectedRepliesRegex.String(), mock.Got[0])
+			}
+		})
+	}
+}
@@ -1,19 +1,356 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
 	"time"
 )
 
-const defaultLoopInterval = 1
+const (
+	defaultLoopInterval = time.Second
+	defaultStorePath    = "turnipfinder.json"
+	defaultSlackAddr    = ":3000"
+
+	configEnvPrefix = "TURNIPFINDER_"
+	configRedacted  = "REDACTED"
+)
 
 type AppConfig struct {
 	DiscordBotToken string
-	LoopInterval    time.Duration
+	// DiscordGuildID registers slash commands with one guild, where they
+	// update immediately, instead of globally.
+	DiscordGuildID string
+	LoopInterval   time.Duration
+	StorePath      string
+	// Sources are the names of the island sources to poll.
+	Sources               []string
+	MinTurnipPriceAllowed int
+	MaxTurnipPriceAllowed int
+	LogLevel              string
+	// SMTPAddr is the host:port of the mail server used to email islands.
+	// Email is disabled without it.
+	SMTPAddr     string
+	SMTPFrom     string
+	SMTPUsername string
+	SMTPPassword string
+	// TelegramBotToken enables the Telegram bot. TelegramBaseURL overrides
+	// the Bot API address.
+	TelegramBotToken string
+	TelegramBaseURL  string
+	// SlackBotToken enables the Slack app, which listens for slash commands
+	// and events on SlackListenAddr. SlackBaseURL overrides the Web API
+	// address.
+	SlackBotToken      string
+	SlackSigningSecret string
+	SlackListenAddr    string
+	SlackBaseURL       string
 }
 
 func NewConfig(DiscordBotToken string) *AppConfig {
 	return &AppConfig{
-		DiscordBotToken: DiscordBotToken,
-		LoopInterval:    defaultLoopInterval,
+		DiscordBotToken:       DiscordBotToken,
+		LoopInterval:          defaultLoopInterval,
+		StorePath:             defaultStorePath,
+		Sources:               []string{SourceTurnipExchange},
+		MinTurnipPriceAllowed: defaultMinTurnipPriceAllowed,
+		MaxTurnipPriceAllowed: defaultMaxTurnipPriceAllowed,
+		LogLevel:              LogLevelInfo,
+		SlackListenAddr:       defaultSlackAddr,
+	}
+}
+
+// configOption is a setting that can be given as a flag, an environment
+// variable or a key in the config file, all with the same name.
+type configOption struct {
+	Name   string
+	Usage  string
+	Secret bool
+	Value  flag.Value
+}
+
+// EnvName is the environment variable for the option, such as
+// TURNIPFINDER_LOOP_INTERVAL.
+func (o configOption) EnvName() string {
+	return configEnvPrefix + strings.ToUpper(strings.ReplaceAll(o.Name, "-", "_"))
+}
+
+func (c *AppConfig) options() []configOption {
+	return []configOption{
+		{Name: "discord-token", Usage: "Discord bot token; without a chat token commands are read from stdin", Secret: true, Value: (*configString)(&c.DiscordBotToken)},
+		{Name: "discord-guild", Usage: "register slash commands with this guild only", Value: (*configString)(&c.DiscordGuildID)},
+		{Name: "loop-interval", Usage: "time between polls, like 30s", Value: (*configDuration)(&c.LoopInterval)},
+		{Name: "store", Usage: "state file path", Value: (*configString)(&c.StorePath)},
+		{Name: "sources", Usage: "comma separated island sources: " + strings.Join(SourceNames(), ", "), Value: (*configList)(&c.Sources)},
+		{Name: "min-price", Usage: "lowest turnip price users may set", Value: (*configInt)(&c.MinTurnipPriceAllowed)},
+		{Name: "max-price", Usage: "highest turnip price users may set", Value: (*configInt)(&c.MaxTurnipPriceAllowed)},
+		{Name: "log-level", Usage: "debug, info or off", Value: (*configString)(&c.LogLevel)},
+		{Name: "smtp-addr", Usage: "host:port of the mail server; email is disabled without it", Value: (*configString)(&c.SMTPAddr)},
+		{Name: "smtp-from", Usage: "sender address for email", Value: (*configString)(&c.SMTPFrom)},
+		{Name: "smtp-username", Usage: "mail server username", Value: (*configString)(&c.SMTPUsername)},
+		{Name: "smtp-password", Usage: "mail server password", Secret: true, Value: (*configString)(&c.SMTPPassword)},
+		{Name: "telegram-token", Usage: "Telegram bot token", Secret: true, Value: (*configString)(&c.TelegramBotToken)},
+		{Name: "telegram-url", Usage: "Telegram Bot API address", Value: (*configString)(&c.TelegramBaseURL)},
+		{Name: "slack-token", Usage: "Slack bot token", Secret: true, Value: (*configString)(&c.SlackBotToken)},
+		{Name: "slack-signing-secret", Usage: "Slack signing secret", Secret: true, Value: (*configString)(&c.SlackSigningSecret)},
+		{Name: "slack-addr", Usage: "address to listen for Slack requests on", Value: (*configString)(&c.SlackListenAddr)},
+		{Name: "slack-url", Usage: "Slack Web API address", Value: (*configString)(&c.SlackBaseURL)},
+	}
+}
+
+// ConfigRequest is what LoadConfig was asked to do besides configuring.
+type ConfigRequest struct {
+	PrintConfig bool
+}
+
+// LoadConfig builds the configuration from defaults, then the config file,
+// then TURNIPFINDER_* environment variables and finally flags, each
+// overriding the ones before. Empty environment variables count as unset, so
+// they cannot clear a value from the config file; an empty flag such as
+// --smtp-addr= can. For compatibility the first two arguments may be the
+// Discord token and store path, unless the matching flag is also given.
+func LoadConfig(args []string, getenv func(string) string, output io.Writer) (*AppConfig, ConfigRequest, error) {
+	var request ConfigRequest
+
+	// Flags are parsed into a scratch config first to find the config file;
+	// they are applied to the real config last.
+	scratch := NewConfig("")
+	configPath := getenv(configEnvPrefix + "CONFIG")
+
+	fs := flag.NewFlagSet("turnipfinder", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&configPath, "config", configPath, "JSON config file")
+	fs.BoolVar(&request.PrintConfig, "print-config", false, "print the configuration with secrets redacted and exit")
+	for _, option := range scratch.options() {
+		fs.Var(option.Value, option.Name, fmt.Sprintf("%s (%s)", option.Usage, option.EnvName()))
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(output, "Usage: turnipfinder [flags] [discord-token [store]]\n\nFlags override %s* environment variables, which override the config file. Empty environment variables are ignored.\n\n", configEnvPrefix)
+		fs.PrintDefaults()
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, request, err
+	}
+
+	config := NewConfig("")
+	options := make(map[string]configOption)
+	for _, option := range config.options() {
+		options[option.Name] = option
+	}
+
+	if configPath != "" {
+		err := config.loadFile(configPath, options)
+		if err != nil {
+			return nil, request, err
+		}
+	}
+
+	for _, option := range config.options() {
+		if value := getenv(option.EnvName()); value != "" {
+			err := option.Value.Set(value)
+			if err != nil {
+				return nil, request, fmt.Errorf("%s: %w", option.EnvName(), err)
+			}
+		}
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		if option, ok := options[f.Name]; ok && err == nil {
+			err = option.Value.Set(f.Value.String())
+		}
+	})
+	if err != nil {
+		return nil, request, err
+	}
+
+	positional := fs.Args()
+	if len(positional) > 2 {
+		return nil, request, fmt.Errorf("Unexpected arguments %q", positional[2:])
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for idx, name := range []string{"discord-token", "store"} {
+		if idx < len(positional) && set[name] {
+			return nil, request, fmt.Errorf("%s was given as both a flag and an argument", name)
+		}
+	}
+	if len(positional) > 0 {
+		config.DiscordBotToken = positional[0]
+	}
+	if len(positional) > 1 {
+		config.StorePath = positional[1]
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return nil, request, err
+	}
+
+	return config, request, nil
+}
+
+// loadFile reads a JSON object keyed by option name. Values may be strings,
+// numbers, booleans or, for lists, arrays of strings.
+func (c *AppConfig) loadFile(path string, options map[string]configOption) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&values)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for name, raw := range values {
+		option, ok := options[name]
+		if !ok {
+			return fmt.Errorf("%s: unknown setting %q", path, name)
+		}
+
+		value, err := configFileValue(raw)
+		if err == nil {
+			err = option.Value.Set(value)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", path, name, err)
+		}
+	}
+
+	return nil
+}
+
+func configFileValue(raw interface{}) (string, error) {
+	switch value := raw.(type) {
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case []interface{}:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("lists may only hold strings")
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	}
+
+	return "", fmt.Errorf("unsupported value %v", raw)
+}
+
+func (c *AppConfig) Validate() error {
+	if c.LoopInterval <= 0 {
+		return fmt.Errorf("loop-interval must be positive")
+	}
+	if c.MinTurnipPriceAllowed > c.MaxTurnipPriceAllowed {
+		return fmt.Errorf("min-price must not be above max-price")
+	}
+	if c.SlackBotToken != "" && c.SlackSigningSecret == "" {
+		return fmt.Errorf("slack-token needs slack-signing-secret")
+	}
+	for _, name := range c.Sources {
+		if _, ok := sourceFactories[name]; !ok {
+			return fmt.Errorf("Unknown source %q, choose from %s", name, strings.Join(SourceNames(), ", "))
+		}
+	}
+
+	return ValidateLogLevel(c.LogLevel)
+}
+
+// Redacted returns the configuration as config file JSON with secrets
+// replaced, so it can be shared or used as a starting point.
+func (c *AppConfig) Redacted() ([]byte, error) {
+	values := make(map[string]interface{})
+	for _, option := range c.options() {
+		switch value := option.Value.(type) {
+		case *configList:
+			values[option.Name] = append([]string{}, *value...)
+		case *configInt:
+			values[option.Name] = int(*value)
+		default:
+			values[option.Name] = value.String()
+		}
+
+		if option.Secret && option.Value.String() != "" {
+			values[option.Name] = configRedacted
+		}
+	}
+
+	return json.MarshalIndent(values, "", "  ")
+}
+
+type configString string
+
+func (v *configString) String() string { return string(*v) }
+
+func (v *configString) Set(s string) error {
+	*v = configString(s)
+	return nil
+}
+
+type configInt int
+
+func (v *configInt) String() string { return strconv.Itoa(int(*v)) }
+
+func (v *configInt) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a number", s)
 	}
+
+	*v = configInt(n)
+	return nil
+}
+
+type configDuration time.Duration
+
+func (v *configDuration) String() string { return time.Duration(*v).String() }
+
+// Set accepts durations like 30s, or a plain number of seconds.
+func (v *configDuration) Set(s string) error {
+	if seconds, err := strconv.Atoi(s); err == nil {
+		*v = configDuration(time.Duration(seconds) * time.Second)
+		return nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a duration", s)
+	}
+
+	*v = configDuration(d)
+	return nil
+}
+
+type configList []string
+
+func (v *configList) String() string { return strings.Join(*v, ",") }
+
+func (v *configList) Set(s string) error {
+	items := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	*v = items
+	return nil
 }
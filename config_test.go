@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := tempStorePath(t)
+	err := ioutil.WriteFile(path, []byte(`{
+		"discord-token": "file-token",
+		"loop-interval": "1m",
+		"min-price": 50,
+		"max-price": 700,
+		"sources": ["turnipexchange"],
+		"log-level": "debug"
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testTable := []struct {
+		Name          string
+		Args          []string
+		Env           map[string]string
+		Expected      func(config *AppConfig)
+		ExpectedError string
+	}{
+		{
+			Name: "Uses defaults",
+			Expected: func(config *AppConfig) {
+				config.DiscordBotToken = ""
+			},
+		}, {
+			Name: "Reads the config file",
+			Args: []string{"--config", path},
+			Expected: func(config *AppConfig) {
+				config.DiscordBotToken = "file-token"
+				config.LoopInterval = time.Minute
+				config.MinTurnipPriceAllowed = 50
+				config.MaxTurnipPriceAllowed = 700
+				config.LogLevel = LogLevelDebug
+			},
+		}, {
+			Name: "Prefers environment variables to the file",
+			Env:  map[string]string{"TURNIPFINDER_CONFIG": path, "TURNIPFINDER_DISCORD_TOKEN": "env-token", "TURNIPFINDER_LOOP_INTERVAL": "30"},
+			Expected: func(config *AppConfig) {
+				config.DiscordBotToken = "env-token"
+				config.LoopInterval = 30 * time.Second
+				config.MinTurnipPriceAllowed = 50
+				config.MaxTurnipPriceAllowed = 700
+				config.LogLevel = LogLevelDebug
+			},
+		}, {
+			Name: "Prefers flags to environment variables",
+			Args: []string{"--config", path, "--discord-token", "flag-token", "--max-price", "650", "--store", "flag.json"},
+			Env:  map[string]string{"TURNIPFINDER_DISCORD_TOKEN": "env-token", "TURNIPFINDER_MAX_PRICE": "600"},
+			Expected: func(config *AppConfig) {
+				config.DiscordBotToken = "flag-token"
+				config.LoopInterval = time.Minute
+				config.MinTurnipPriceAllowed = 50
+				config.MaxTurnipPriceAllowed = 650
+				config.LogLevel = LogLevelDebug
+				config.StorePath = "flag.json"
+			},
+		}, {
+			Name: "Accepts the token and store as arguments",
+			Args: []string{"--log-level", "off", "arg-token", "arg.json"},
+			Expected: func(config *AppConfig) {
+				config.DiscordBotToken = "arg-token"
+				config.StorePath = "arg.json"
+				config.LogLevel = LogLevelOff
+			},
+		}, {
+			Name:          "Rejects a token given as a flag and an argument",
+			Args:          []string{"--discord-token", "flag-token", "arg-token"},
+			ExpectedError: "discord-token was given as both a flag and an argument",
+		}, {
+			Name:          "Rejects a store given as a flag and an argument",
+			Args:          []string{"--store", "flag.json", "arg-token", "arg.json"},
+			ExpectedError: "store was given as both a flag and an argument",
+		}, {
+			Name: "Ignores empty environment variables",
+			Args: []string{"--config", path},
+			Env:  map[string]string{"TURNIPFINDER_DISCORD_TOKEN": ""},
+			Expected: func(config *AppConfig) {
+				config.DiscordBotToken = "file-token"
+				config.LoopInterval = time.Minute
+				config.MinTurnipPriceAllowed = 50
+				config.MaxTurnipPriceAllowed = 700
+				config.LogLevel = LogLevelDebug
+			},
+		}, {
+			Name: "Clears a file setting with an empty flag",
+			Args: []string{"--config", path, "--discord-token="},
+			Expected: func(config *AppConfig) {
+				config.LoopInterval = time.Minute
+				config.MinTurnipPriceAllowed = 50
+				config.MaxTurnipPriceAllowed = 700
+				config.LogLevel = LogLevelDebug
+			},
+		}, {
+			Name:          "Rejects invalid numbers",
+			Env:           map[string]string{"TURNIPFINDER_MIN_PRICE": "lots"},
+			ExpectedError: `TURNIPFINDER_MIN_PRICE: "lots" is not a number`,
+		}, {
+			Name:          "Rejects unknown sources",
+			Args:          []string{"--sources", "turnipexchange,nookazon"},
+			ExpectedError: `Unknown source "nookazon"`,
+		}, {
+			Name:          "Rejects crossed price bounds",
+			Args:          []string{"--min-price", "900"},
+			ExpectedError: "min-price must not be above max-price",
+		}, {
+			Name:          "Rejects Slack without a signing secret",
+			Args:          []string{"--slack-token", "xoxb-token"},
+			ExpectedError: "slack-token needs slack-signing-secret",
+		}, {
+			Name:          "Rejects unknown log levels",
+			Args:          []string{"--log-level", "loud"},
+			ExpectedError: `Unknown log level "loud"`,
+		}, {
+			Name:          "Rejects unknown flags",
+			Args:          []string{"--colour"},
+			ExpectedError: "flag provided but not defined",
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			getenv := func(name string) string {
+				return tcase.Env[name]
+			}
+
+			config, _, err := LoadConfig(tcase.Args, getenv, ioutil.Discard)
+			if tcase.ExpectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tcase.ExpectedError) {
+					t.Errorf("Expected error containing %q but received %v", tcase.ExpectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected error to be nil but received %v", err)
+			}
+
+			expected := NewConfig("")
+			tcase.Expected(expected)
+			if !reflect.DeepEqual(config, expected) {
+				t.Errorf("Expected config %+v but received %+v", expected, config)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	path := tempStorePath(t)
+	err := ioutil.WriteFile(path, []byte(`{"discord-tokn": "typo"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = LoadConfig([]string{"--config", path}, func(string) string { return "" }, ioutil.Discard)
+	if err == nil || !strings.Contains(err.Error(), `unknown setting "discord-tokn"`) {
+		t.Errorf("Expected unknown settings to be rejected but received %v", err)
+	}
+
+	_, _, err = LoadConfig([]string{"-h"}, func(string) string { return "" }, ioutil.Discard)
+	if err != flag.ErrHelp {
+		t.Errorf("Expected flag.ErrHelp but received %v", err)
+	}
+}
+
+func TestConfigRedacted(t *testing.T) {
+	config, request, err := LoadConfig([]string{"--print-config", "--slack-token", "xoxb-secret", "--slack-signing-secret", "slack-hmac-secret", "--smtp-addr", "mail:25"}, func(name string) string {
+		if name == "TURNIPFINDER_DISCORD_TOKEN" {
+			return "discord-secret"
+		}
+		return ""
+	}, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("Expected error to be nil but received %v", err)
+	}
+	if !request.PrintConfig {
+		t.Error("Expected the config to be printed")
+	}
+
+	data, err := config.Redacted()
+	if err != nil {
+		t.Fatalf("Expected error to be nil but received %v", err)
+	}
+	if strings.Contains(string(data), "xoxb-secret") || strings.Contains(string(data), "discord-secret") || strings.Contains(string(data), "slack-hmac-secret") {
+		t.Errorf("Expected secrets to be redacted but received %s", data)
+	}
+
+	var printed map[string]interface{}
+	json.Unmarshal(data, &printed)
+	if printed["discord-token"] != configRedacted || printed["slack-token"] != configRedacted || printed["telegram-token"] != "" {
+		t.Errorf("Expected set secrets to be redacted and empty ones left empty but received %s", data)
+	}
+	if printed["smtp-addr"] != "mail:25" || printed["loop-interval"] != "1s" || printed["max-price"] != float64(defaultMaxTurnipPriceAllowed) {
+		t.Errorf("Expected settings to be printed but received %s", data)
+	}
+
+	// The printed config can be used as a config file once secrets are
+	// filled back in.
+	path := tempStorePath(t)
+	ioutil.WriteFile(path, data, 0600)
+	reloaded, _, err := LoadConfig([]string{"--config", path}, func(string) string { return "" }, ioutil.Discard)
+	if err != nil || reloaded.SMTPAddr != "mail:25" {
+		t.Errorf("Expected the printed config to load but received %+v, %v", reloaded, err)
+	}
+}
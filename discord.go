@@ -1,10 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/bwmarrin/discordgo"
 	"log"
+	"strconv"
 	"strings"
+	"sync"
+)
+
+const (
+	discordMaxContent     = 2000
+	discordMaxDescription = 100
+	discordMaxChoices     = 25
 )
 
 func DiscordConnect(token string) (*discordgo.Session, error) {
@@ -21,23 +30,91 @@ func DiscordConnect(token string) (*discordgo.Session, error) {
 	return sess, nil
 }
 
-func DiscordSendUserMessageWrapper(dg *discordgo.Session) func(user User, msg string) error {
-	return func(user User, msg string) error {
-		dgUser, err := dg.User(user.ID)
-		if err != nil {
-			return err
-		}
+// DiscordNotifier sends direct messages to Discord users by ID.
+type DiscordNotifier struct {
+	Session *discordgo.Session
+}
 
-		dgChannel, err := dg.UserChannelCreate(dgUser.ID)
-		if err != nil {
-			return err
+func NewDiscordNotifier(dg *discordgo.Session) *DiscordNotifier {
+	return &DiscordNotifier{Session: dg}
+}
+
+func (n *DiscordNotifier) Capabilities() NotifierCapabilities {
+	return NotifierCapabilities{Embeds: true, MaxLength: discordMaxContent}
+}
+
+func (n *DiscordNotifier) Send(ctx context.Context, recipient string, message Message) error {
+	dgChannel, err := n.Session.UserChannelCreate(recipient, discordgo.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	_, err = n.Session.ChannelMessageSendComplex(dgChannel.ID, DiscordMessageSend(message), discordgo.WithContext(ctx))
+	return err
+}
+
+// Close disconnects the session.
+func (n *DiscordNotifier) Close() error {
+	return n.Session.Close()
+}
+
+// DiscordSendChannelMessageWrapper posts to a subscribed channel, mentioning
+// the channel's role if it has one.
+func DiscordSendChannelMessageWrapper(dg *discordgo.Session) func(channel Channel, msg Message) error {
+	return func(channel Channel, msg Message) error {
+		data := DiscordMessageSend(msg)
+		if channel.MentionRoleID != "" {
+			mention := fmt.Sprintf("<@&%s>", channel.MentionRoleID)
+			data.Content = strings.TrimSpace(mention + " " + data.Content)
+			data.AllowedMentions.Roles = []string{channel.MentionRoleID}
 		}
 
-		_, err = dg.ChannelMessageSend(dgChannel.ID, msg)
+		_, err := dg.ChannelMessageSendComplex(channel.ID, data)
 		return err
 	}
 }
 
+// DiscordMessageSend converts a message to a Discord message. Messages with
+// an embed are sent as the embed alone, with a link button when it has a
+// link, and other messages as their text. Mentions are not allowed unless the
+// caller adds them.
+func DiscordMessageSend(msg Message) *discordgo.MessageSend {
+	data := &discordgo.MessageSend{AllowedMentions: &discordgo.MessageAllowedMentions{}}
+	if msg.Embed == nil {
+		data.Content = msg.Text
+		return data
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       msg.Embed.Title,
+		URL:         msg.Embed.URL,
+		Description: msg.Embed.Description,
+		Color:       msg.Embed.Color,
+	}
+	for _, field := range msg.Embed.Fields {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: field.Name, Value: field.Value, Inline: field.Inline})
+	}
+	if msg.Embed.Footer != "" {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: msg.Embed.Footer}
+	}
+	data.Embeds = []*discordgo.MessageEmbed{embed}
+
+	if msg.Embed.Link != "" {
+		data.Components = []discordgo.MessageComponent{
+			discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+				discordgo.Button{Label: "Open island", Style: discordgo.LinkButton, URL: msg.Embed.Link},
+			}},
+		}
+	}
+
+	return data
+}
+
+// discordIsAdmin reports whether the permissions allow managing the channel.
+func discordIsAdmin(permissions int64) bool {
+	return permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageChannels) != 0
+}
+
 func DiscordCreateMessageWrapper(tf *TurnipFinder) func(s *discordgo.Session, m *discordgo.MessageCreate) {
 	return func(s *discordgo.Session, m *discordgo.MessageCreate) {
 		// Ignore all messages created by the bot itself
@@ -45,29 +122,37 @@ func DiscordCreateMessageWrapper(tf *TurnipFinder) func(s *discordgo.Session, m
 			return
 		}
 
-		if m.Content[0:1] == "!" {
-			fields := strings.Fields(m.Content)
+		fields := strings.Fields(m.Content)
+		if len(fields) > 0 && len(fields[0]) > 1 && strings.HasPrefix(fields[0], "!") {
 			cmd := fields[0][1:]
 
-			user, err := tf.User(m.Author.ID)
+			user, err := tf.TransportUser(NotifierDiscord, m.Author.ID, m.Author.Username)
 			if err != nil {
-				user = tf.AddUserWithName(m.Author.ID, m.Author.Username)
+				log.Println(err)
+				return
 			}
 
+			// Replies are always direct messages, whichever notifiers the
+			// user is sent islands with.
+			notifier := NewDiscordNotifier(s)
 			reply := func(msg string) error {
-				err := tf.SendUserMessage(user, msg)
-				if err != nil {
-					return err
-				}
-
-				return nil
+				return notifier.Send(context.Background(), m.Author.ID, notifier.Capabilities().Adapt(TextMessage(msg)))
 			}
 
 			commandInput := ChatCommandInput{
-				Name:  cmd,
-				Args:  strings.Join(fields[1:], " "), // Replace with Regex
-				User:  user,
-				Reply: reply,
+				Name:      cmd,
+				Args:      strings.Join(fields[1:], " "), // Replace with Regex
+				User:      user,
+				ChannelID: m.ChannelID,
+				GuildID:   m.GuildID,
+				Reply:     reply,
+			}
+			if m.GuildID != "" {
+				permissions, err := s.UserChannelPermissions(m.Author.ID, m.ChannelID)
+				if err != nil {
+					log.Println(err)
+				}
+				commandInput.Admin = discordIsAdmin(permissions)
 			}
 
 			err = tf.RunCommand(commandInput)
@@ -77,3 +162,180 @@ func DiscordCreateMessageWrapper(tf *TurnipFinder) func(s *discordgo.Session, m
 		}
 	}
 }
+
+// DiscordApplicationCommands converts commands to Discord application
+// commands. Arguments with fixed choices become choice options and arguments
+// that can be completed, including repeated choices, use autocomplete.
+func DiscordApplicationCommands(commands []Command) []*discordgo.ApplicationCommand {
+	appCommands := make([]*discordgo.ApplicationCommand, 0, len(commands))
+	for _, cmd := range commands {
+		appCommand := &discordgo.ApplicationCommand{
+			Name:        cmd.Name,
+			Description: discordDescription(cmd.Description, cmd.Name),
+			Options:     make([]*discordgo.ApplicationCommandOption, 0, len(cmd.Args)),
+		}
+
+		for _, arg := range cmd.Args {
+			option := &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        arg.Name,
+				Description: discordDescription(arg.Description, arg.Name),
+				Required:    !arg.Optional,
+			}
+
+			switch {
+			case arg.Type == CommandArgInt:
+				option.Type = discordgo.ApplicationCommandOptionInteger
+			case arg.Complete != nil || arg.Repeated:
+				option.Autocomplete = true
+			case len(arg.Choices) > 0:
+				for _, choice := range arg.Choices {
+					option.Choices = append(option.Choices, &discordgo.ApplicationCommandOptionChoice{Name: choice, Value: choice})
+				}
+			}
+
+			appCommand.Options = append(appCommand.Options, option)
+		}
+
+		appCommands = append(appCommands, appCommand)
+	}
+
+	return appCommands
+}
+
+func discordDescription(description string, fallback string) string {
+	if description == "" {
+		description = fallback
+	}
+	if len(description) > discordMaxDescription {
+		description = description[:discordMaxDescription-3] + "..."
+	}
+
+	return description
+}
+
+// DiscordRegisterCommands replaces the bot's application commands with the
+// registered commands. An empty guildID registers them globally.
+func DiscordRegisterCommands(dg *discordgo.Session, tf *TurnipFinder, guildID string) error {
+	_, err := dg.ApplicationCommandBulkOverwrite(dg.State.User.ID, guildID, DiscordApplicationCommands(tf.Commands()))
+	return err
+}
+
+// discordInteractionOptions returns the interaction's options by name.
+func discordInteractionOptions(options []*discordgo.ApplicationCommandInteractionDataOption) map[string]string {
+	values := make(map[string]string, len(options))
+	for _, option := range options {
+		switch value := option.Value.(type) {
+		case float64:
+			values[option.Name] = strconv.FormatInt(int64(value), 10)
+		default:
+			values[option.Name] = fmt.Sprint(value)
+		}
+	}
+
+	return values
+}
+
+func discordInteractionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil && i.Member.User != nil {
+		return i.Member.User
+	}
+
+	return i.User
+}
+
+// DiscordInteractionCreateWrapper runs application commands through
+// RunCommand and answers autocomplete requests. Replies are only visible to
+// the user who ran the command.
+func DiscordInteractionCreateWrapper(tf *TurnipFinder) func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	return func(s *discordgo.Session, i *discordgo.InteractionCreate) {
+		if i.Type != discordgo.InteractionApplicationCommand && i.Type != discordgo.InteractionApplicationCommandAutocomplete {
+			return
+		}
+
+		dgUser := discordInteractionUser(i)
+		if dgUser == nil {
+			return
+		}
+
+		user, err := tf.TransportUser(NotifierDiscord, dgUser.ID, dgUser.Username)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		data := i.ApplicationCommandData()
+		if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+			err = discordAutocomplete(s, i, tf, user, data)
+		} else {
+			input := ChatCommandInput{
+				Name:      data.Name,
+				Options:   discordInteractionOptions(data.Options),
+				User:      user,
+				ChannelID: i.ChannelID,
+				GuildID:   i.GuildID,
+				Reply:     discordInteractionReply(s, i),
+			}
+			if i.Member != nil {
+				input.Admin = discordIsAdmin(i.Member.Permissions)
+			}
+
+			err = tf.RunCommand(input)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// discordInteractionReply responds to the interaction with the first reply
+// and sends any further replies as follow up messages.
+func discordInteractionReply(s *discordgo.Session, i *discordgo.InteractionCreate) func(string) error {
+	var mu sync.Mutex
+	responded := false
+
+	return func(msg string) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !responded {
+			responded = true
+			return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+				Type: discordgo.InteractionResponseChannelMessageWithSource,
+				Data: &discordgo.InteractionResponseData{Content: msg, Flags: discordgo.MessageFlagsEphemeral},
+			})
+		}
+
+		_, err := s.FollowupMessageCreate(i.Interaction, false, &discordgo.WebhookParams{Content: msg, Flags: discordgo.MessageFlagsEphemeral})
+		return err
+	}
+}
+
+func discordAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate, tf *TurnipFinder, user User, data discordgo.ApplicationCommandInteractionData) error {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0)
+
+	cmd, ok := tf.GetCommand(data.Name)
+	for _, option := range data.Options {
+		if !ok || !option.Focused {
+			continue
+		}
+
+		for _, arg := range cmd.Args {
+			if arg.Name != option.Name {
+				continue
+			}
+
+			for _, completion := range tf.CompleteArg(user, arg, fmt.Sprint(option.Value)) {
+				if len(choices) == discordMaxChoices {
+					break
+				}
+				choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: completion, Value: completion})
+			}
+		}
+	}
+
+	return s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+}
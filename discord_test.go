@@ -0,0 +1,152 @@
+package main
+
+import (
+	"github.com/bwmarrin/discordgo"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiscordApplicationCommands(t *testing.T) {
+	commands := map[string]*discordgo.ApplicationCommand{}
+	for _, cmd := range DiscordApplicationCommands(DefaultCommands()) {
+		commands[cmd.Name] = cmd
+		if len(cmd.Description) == 0 || len(cmd.Description) > discordMaxDescription {
+			t.Errorf("Expected /%s to have a description of 1 to %d characters but found %d", cmd.Name, discordMaxDescription, len(cmd.Description))
+		}
+	}
+
+	sell := commands["sell"].Options[0]
+	if sell.Type != discordgo.ApplicationCommandOptionInteger || !sell.Required {
+		t.Errorf("Expected /sell to take a required integer but found %+v", sell)
+	}
+
+	action := commands["watch"].Options[0]
+	if len(action.Choices) != 5 || action.Autocomplete {
+		t.Errorf("Expected /watch action to list its choices but found %+v", action)
+	}
+
+	for _, option := range []*discordgo.ApplicationCommandOption{commands["watch"].Options[1], commands["notify"].Options[0], commands["help"].Options[0]} {
+		if !option.Autocomplete || len(option.Choices) != 0 {
+			t.Errorf("Expected %s to use autocomplete but found %+v", option.Name, option)
+		}
+	}
+}
+
+func TestDiscordInteractionOptions(t *testing.T) {
+	tf := New()
+	tf.RegisterDefaultCommands()
+	tf.AddNotifier(NotifierEmail, newMockNotifier(NotifierCapabilities{}, nil))
+	tf.SetUser(User{ID: "discord:1"})
+
+	testTable := []struct {
+		Name           string
+		Command        string
+		Options        []*discordgo.ApplicationCommandInteractionDataOption
+		ExpectedValues CommandValues
+		ExpectedReply  string
+	}{
+		{
+			Name:    "Keeps options in place when an optional one is left out",
+			Command: "watch",
+			Options: []*discordgo.ApplicationCommandInteractionDataOption{
+				{Name: "expression", Type: discordgo.ApplicationCommandOptionString, Value: "price>500"},
+				{Name: "action", Type: discordgo.ApplicationCommandOptionString, Value: "add"},
+			},
+			ExpectedValues: CommandValues{"action": "add", "expression": "price>500"},
+		}, {
+			Name:    "Does not take a recipient for the notifier",
+			Command: "deliver",
+			Options: []*discordgo.ApplicationCommandInteractionDataOption{
+				{Name: "action", Type: discordgo.ApplicationCommandOptionString, Value: "add"},
+				{Name: "recipient", Type: discordgo.ApplicationCommandOptionString, Value: "me@example.com"},
+			},
+			ExpectedValues: CommandValues{"action": "add", "recipient": "me@example.com"},
+			ExpectedReply:  "Missing notifier",
+		}, {
+			Name:    "Formats integers as whole numbers",
+			Command: "sell",
+			Options: []*discordgo.ApplicationCommandInteractionDataOption{
+				{Name: "price", Type: discordgo.ApplicationCommandOptionInteger, Value: float64(500)},
+			},
+			ExpectedValues: CommandValues{"price": 500},
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			cmd, _ := tf.GetCommand(tcase.Command)
+			values, err := cmd.ParseOptions(discordInteractionOptions(tcase.Options))
+			if err != nil {
+				t.Fatalf("Expected error to be nil but received %v", err)
+			}
+			if !reflect.DeepEqual(values, tcase.ExpectedValues) {
+				t.Errorf("Expected values %v but received %v", tcase.ExpectedValues, values)
+			}
+
+			if tcase.ExpectedReply == "" {
+				return
+			}
+			user, _ := tf.User("discord:1")
+			mock, reply := mockReply(false)
+			tf.RunCommand(ChatCommandInput{Name: tcase.Command, Options: discordInteractionOptions(tcase.Options), User: user, Reply: reply})
+			if len(mock.Got) != 1 || !strings.HasPrefix(mock.Got[0], tcase.ExpectedReply) {
+				t.Errorf("Expected a reply starting %q but received %q", tcase.ExpectedReply, mock.Got)
+			}
+		})
+	}
+}
+
+func TestCompleteArg(t *testing.T) {
+	tf := New()
+	tf.RegisterDefaultCommands()
+	user := User{ID: "foo", Watches: []Watch{{Name: "sell-high"}, {Name: "sell-ok"}, {Name: "cheap"}}}
+
+	testTable := []struct {
+		Name     string
+		Command  string
+		Arg      int
+		Prefix   string
+		Expected []string
+	}{
+		{Name: "Completes command names", Command: "help", Prefix: "s", Expected: []string{"sell", "sources", "status", "stop"}},
+		{Name: "Completes the user's watch names", Command: "watch", Arg: 1, Prefix: "SELL", Expected: []string{"sell-high", "sell-ok"}},
+		{Name: "Completes the last repeated word", Command: "notify", Prefix: "added up", Expected: []string{"added updated"}},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			cmd, _ := tf.GetCommand(tcase.Command)
+			completions := tf.CompleteArg(user, cmd.Args[tcase.Arg], tcase.Prefix)
+			if !reflect.DeepEqual(completions, tcase.Expected) {
+				t.Errorf("Expected completions %q but received %q", tcase.Expected, completions)
+			}
+		})
+	}
+}
+
+func TestDiscordMessageSend(t *testing.T) {
+	text := DiscordMessageSend(TextMessage("hello"))
+	if text.Content != "hello" || len(text.Embeds) != 0 {
+		t.Errorf("Expected text messages to be sent as content but received %+v", text)
+	}
+
+	island := Island{Name: "Nook", TurnipPrice: 512, InQueue: 4, MaxQueue: 20, URL: "https://example.com/island/1"}
+	rich := DiscordMessageSend(New().RenderIslandMessage(island, FormatFull, ""))
+	if rich.Content != "" || len(rich.Embeds) != 1 {
+		t.Fatalf("Expected rich messages to be sent as an embed but received %+v", rich)
+	}
+	if rich.Embeds[0].Title != "Nook" || rich.Embeds[0].Color != PriceColor(island) || len(rich.Embeds[0].Fields) != 3 {
+		t.Errorf("Unexpected embed %+v", rich.Embeds[0])
+	}
+	if len(rich.Components) != 1 {
+		t.Fatalf("Expected a link button but received %+v", rich.Components)
+	}
+	button := rich.Components[0].(discordgo.ActionsRow).Components[0].(discordgo.Button)
+	if button.Style != discordgo.LinkButton || button.URL != island.URL {
+		t.Errorf("Expected a link button to the island but received %+v", button)
+	}
+	if rich.AllowedMentions == nil || len(rich.AllowedMentions.Parse) != 0 {
+		t.Errorf("Expected mentions to be disabled but received %+v", rich.AllowedMentions)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log"
+)
+
+// Dispatch sends each event to every polling user who asked for that kind of
+// event and has a watch that passes the island. Each user is evaluated on
+// their own, so one user's settings never affect what another user receives.
+// An island is sent once per user, for the first watch it matches. Channel
+// subscriptions are dispatched after users when a channel transport is set.
+func (tf *TurnipFinder) Dispatch(events []IslandEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	users, err := tf.PollingUsers()
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		watches := tf.userWatches(user)
+		if len(watches) == 0 {
+			continue
+		}
+
+		for _, event := range events {
+			if user.NotifyOn&event.Type == 0 {
+				continue
+			}
+
+			watch, ok := matchWatch(watches, event.Island)
+			if !ok {
+				continue
+			}
+
+			err := tf.SendUserIslandEvent(user, watch, event)
+			if err != nil {
+				log.Printf("Error sending island %s to user %s\n", event.Island.ID, user.ID)
+				log.Println(err)
+			}
+		}
+	}
+
+	return tf.dispatchChannels(events)
+}
+
+// dispatchChannels posts events to every subscribed channel whose filters
+// pass the island.
+func (tf *TurnipFinder) dispatchChannels(events []IslandEvent) error {
+	channels, err := tf.SubscribedChannels()
+	if err != nil {
+		return err
+	}
+
+	for _, channel := range channels {
+		filter := tf.ChannelFilter(channel)
+		for _, event := range events {
+			if channel.NotifyOn&event.Type == 0 || !filter(event.Island) {
+				continue
+			}
+
+			err := tf.SendChannelIslandEvent(channel, event)
+			if err != nil {
+				log.Printf("Error sending island %s to channel %s\n", event.Island.ID, channel.ID)
+				log.Println(err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func matchWatch(watches []userWatch, island Island) (Watch, bool) {
+	for _, watch := range watches {
+		if watch.filter(island) {
+			return watch.Watch, true
+		}
+	}
+
+	return Watch{}, false
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+)
+
+const defaultEmailSubject = "Turnip Finder"
+
+// EmailNotifier sends plain text email through an SMTP server. STARTTLS is
+// used when the server offers it, and Auth only once the connection is
+// encrypted or to localhost, as net/smtp requires.
+type EmailNotifier struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+func NewEmailNotifier(addr string, from string, auth smtp.Auth) *EmailNotifier {
+	return &EmailNotifier{
+		Addr: addr,
+		From: from,
+		Auth: auth,
+	}
+}
+
+func (n *EmailNotifier) Capabilities() NotifierCapabilities {
+	return NotifierCapabilities{}
+}
+
+func (n *EmailNotifier) ValidateRecipient(recipient string) error {
+	addr, err := mail.ParseAddress(recipient)
+	if err != nil || addr.Address != recipient {
+		return fmt.Errorf("%q is not an email address", recipient)
+	}
+
+	return nil
+}
+
+// SendConfirmation mails the code that adds the address, so islands are only
+// sent to people who asked for them.
+func (n *EmailNotifier) SendConfirmation(ctx context.Context, recipient string, code string) error {
+	text := fmt.Sprintf("Turnip Finder confirmation code\n\nSomeone asked Turnip Finder to email islands to this address. If it was you, send the bot:\n\n!deliver confirm email %s\n\nOtherwise you can ignore this email.", code)
+
+	return n.Send(ctx, recipient, TextMessage(text))
+}
+
+func (n *EmailNotifier) Send(ctx context.Context, recipient string, message Message) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.Addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	host, _, err := net.SplitHostPort(n.Addr)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			return err
+		}
+	}
+	if n.Auth != nil {
+		err = client.Auth(n.Auth)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(n.From)
+	if err != nil {
+		return err
+	}
+	err = client.Rcpt(recipient)
+	if err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(n.render(recipient, message))
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (n *EmailNotifier) render(recipient string, message Message) []byte {
+	headers := []string{
+		fmt.Sprintf("From: %s", n.From),
+		fmt.Sprintf("To: %s", recipient),
+		fmt.Sprintf("Subject: %s", mime.QEncoding.Encode("utf-8", emailSubject(message))),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: 8bit",
+	}
+
+	// The SMTP data writer turns line endings into CRLF.
+	return []byte(strings.Join(headers, "\n") + "\n\n" + message.Text)
+}
+
+// emailSubject is the first line of the message, so messages read well in an
+// inbox.
+func emailSubject(message Message) string {
+	subject := strings.SplitN(strings.TrimSpace(message.Text), "\n", 2)[0]
+	subject = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' || r == '\t' {
+			return ' '
+		}
+		return r
+	}, subject))
+	if subject == "" {
+		return defaultEmailSubject
+	}
+
+	return truncateText(subject, 100)
+}
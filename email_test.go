@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockSMTPMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+// mockSMTPServer accepts one connection and speaks just enough SMTP for
+// net/smtp, sending the received message on the returned channel.
+func mockSMTPServer(t *testing.T) (string, <-chan mockSMTPMessage) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan mockSMTPMessage, 1)
+	go func() {
+		defer listener.Close()
+
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		text := textproto.NewConn(conn)
+		msg := mockSMTPMessage{}
+		text.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+
+			verb := strings.ToUpper(strings.Fields(line)[0])
+			switch verb {
+			case "EHLO":
+				text.PrintfLine("250-localhost")
+				text.PrintfLine("250 8BITMIME")
+			case "MAIL":
+				msg.From = line
+				text.PrintfLine("250 OK")
+			case "RCPT":
+				msg.To = append(msg.To, line)
+				text.PrintfLine("250 OK")
+			case "DATA":
+				text.PrintfLine("354 Go ahead")
+				lines, err := text.ReadDotLines()
+				if err != nil {
+					return
+				}
+				msg.Data = strings.Join(lines, "\n")
+				text.PrintfLine("250 OK")
+				received <- msg
+			case "QUIT":
+				text.PrintfLine("221 Bye")
+				return
+			default:
+				text.PrintfLine("502 Not implemented")
+			}
+		}
+	}()
+
+	return listener.Addr().String(), received
+}
+
+func TestEmailNotifierSend(t *testing.T) {
+	addr, received := mockSMTPServer(t)
+	notifier := NewEmailNotifier(addr, "bot@example.com", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	message := TextMessage("[sell-high] Nook · 512 bells\n.hidden line\nhttps://example.com/island/1")
+	err := notifier.Send(ctx, "me@example.com", notifier.Capabilities().Adapt(message))
+	if err != nil {
+		t.Fatalf("Expected error to be nil but received %v", err)
+	}
+
+	msg := <-received
+	if msg.From != "MAIL FROM:<bot@example.com> BODY=8BITMIME" && msg.From != "MAIL FROM:<bot@example.com>" {
+		t.Errorf("Unexpected sender %q", msg.From)
+	}
+	if len(msg.To) != 1 || msg.To[0] != "RCPT TO:<me@example.com>" {
+		t.Errorf("Unexpected recipients %q", msg.To)
+	}
+	for _, expected := range []string{
+		"To: me@example.com\n",
+		"Subject: =?utf-8?q?[sell-high]_Nook_=C2=B7_512_bells?=\n",
+		"Content-Type: text/plain; charset=utf-8\n",
+		"\n\n[sell-high] Nook · 512 bells\n.hidden line\nhttps://example.com/island/1",
+	} {
+		if !strings.Contains(msg.Data, expected) {
+			t.Errorf("Expected email to contain %q but received %q", expected, msg.Data)
+		}
+	}
+}
+
+func TestEmailNotifierValidateRecipient(t *testing.T) {
+	notifier := NewEmailNotifier("localhost:25", "bot@example.com", nil)
+	for recipient, valid := range map[string]bool{
+		"me@example.com":            true,
+		"Me <me@example.com>":       false,
+		"me@example.com\r\nBcc: x@": false,
+		"not an address":            false,
+	} {
+		err := notifier.ValidateRecipient(recipient)
+		if (err == nil) != valid {
+			t.Errorf("Expected %q to be valid %t but received %v", recipient, valid, err)
+		}
+	}
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// A filter expression is a condition over island fields, for example
+//
+//	price >= 450 && fee == 0 && queue < 20 && !description ~ "tip"
+//
+// Numbers compare with == != < <= > >=, text compares with == and != (ignoring
+// case) and ~ or !~ (contains, ignoring case). Conditions combine with &&, ||,
+// ! and parentheses. Conditions written next to each other, like
+// price>=550 queue<10, are combined with &&. Ages are in minutes and may be
+// written as 30m, 2h or 1d.
+
+type ErrorFilterExpression struct {
+	Position int
+	Message  string
+}
+
+func (e *ErrorFilterExpression) Error() string {
+	return fmt.Sprintf("%s (at character %d)", e.Message, e.Position)
+}
+
+type exprKind int
+
+const (
+	exprNumber exprKind = iota
+	exprText
+	exprBool
+)
+
+func (k exprKind) String() string {
+	switch k {
+	case exprNumber:
+		return "a number"
+	case exprText:
+		return "text"
+	}
+
+	return "a condition"
+}
+
+type exprValue struct {
+	num  float64
+	str  string
+	bool bool
+}
+
+type exprEnv struct {
+	island Island
+	now    time.Time
+}
+
+type exprNode struct {
+	kind exprKind
+	pos  int
+	eval func(env *exprEnv) exprValue
+}
+
+type exprField struct {
+	kind exprKind
+	get  func(env *exprEnv) exprValue
+}
+
+var filterExpressionFields = map[string]exprField{
+	"price": {exprNumber, func(env *exprEnv) exprValue {
+		return exprValue{num: float64(env.island.TurnipPrice)}
+	}},
+	"fee": {exprNumber, func(env *exprEnv) exprValue {
+		return exprValue{num: float64(env.island.Fee)}
+	}},
+	"queue": {exprNumber, func(env *exprEnv) exprValue {
+		return exprValue{num: float64(env.island.InQueue)}
+	}},
+	"maxqueue": {exprNumber, func(env *exprEnv) exprValue {
+		return exprValue{num: float64(env.island.MaxQueue)}
+	}},
+	"age": {exprNumber, func(env *exprEnv) exprValue {
+		return exprValue{num: IslandAge(env.island, env.now).Minutes()}
+	}},
+	"name": {exprText, func(env *exprEnv) exprValue {
+		return exprValue{str: env.island.Name}
+	}},
+	"category": {exprText, func(env *exprEnv) exprValue {
+		return exprValue{str: env.island.Category}
+	}},
+	"islander": {exprText, func(env *exprEnv) exprValue {
+		return exprValue{str: env.island.Islander}
+	}},
+	"hemisphere": {exprText, func(env *exprEnv) exprValue {
+		return exprValue{str: env.island.Hemisphere}
+	}},
+	"listing": {exprText, func(env *exprEnv) exprValue {
+		return exprValue{str: env.island.Listing.String()}
+	}},
+	"description": {exprText, func(env *exprEnv) exprValue {
+		return exprValue{str: env.island.Description}
+	}},
+}
+
+func FilterExpressionFields() []string {
+	names := make([]string, 0, len(filterExpressionFields))
+	for name := range filterExpressionFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// IslandAge is the time since the island was listed, or since it was first
+// seen when the listing time is unknown.
+func IslandAge(island Island, now time.Time) time.Duration {
+	created, err := time.Parse(time.RFC3339, island.CreateTime)
+	if err != nil {
+		created = island.FirstSeen
+	}
+	if created.IsZero() {
+		return 0
+	}
+
+	return now.Sub(created)
+}
+
+type FilterExpression struct {
+	Source string
+	root   exprNode
+	fields map[string]bool
+}
+
+func ParseFilterExpression(source string) (*FilterExpression, error) {
+	tokens, err := lexFilterExpression(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &exprParser{tokens: tokens, fields: make(map[string]bool)}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, &ErrorFilterExpression{Position: tok.pos, Message: fmt.Sprintf("Unexpected %s", tok)}
+	}
+	if root.kind != exprBool {
+		return nil, &ErrorFilterExpression{Position: root.pos, Message: fmt.Sprintf("Expected a condition like price >= 500 but found %s", root.kind)}
+	}
+
+	return &FilterExpression{Source: source, root: root, fields: p.fields}, nil
+}
+
+// UsesField reports whether the expression refers to the field.
+func (e *FilterExpression) UsesField(name string) bool {
+	return e.fields[name]
+}
+
+func (e *FilterExpression) Match(island Island, now time.Time) bool {
+	return e.root.eval(&exprEnv{island: island, now: now}).bool
+}
+
+func (e *FilterExpression) Filter(now func() time.Time) Filter {
+	return func(island Island) bool {
+		return e.Match(island, now())
+	}
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "!~", "=", "<", ">", "~", "!", "(", ")"}
+
+var exprDurationUnits = map[rune]float64{
+	'm': 1,
+	'h': 60,
+	'd': 24 * 60,
+}
+
+func lexFilterExpression(source string) ([]exprToken, error) {
+	runes := []rune(source)
+	tokens := make([]exprToken, 0)
+
+	for idx := 0; idx < len(runes); {
+		r := runes[idx]
+		pos := idx + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			idx++
+		case r == '"' || r == '\'':
+			var text strings.Builder
+			idx++
+			for ; idx < len(runes) && runes[idx] != r; idx++ {
+				if runes[idx] == '\\' && idx+1 < len(runes) {
+					idx++
+				}
+				text.WriteRune(runes[idx])
+			}
+			if idx >= len(runes) {
+				return nil, &ErrorFilterExpression{Position: pos, Message: "Text is missing its closing quote"}
+			}
+			idx++
+			tokens = append(tokens, exprToken{kind: tokenString, text: text.String(), pos: pos})
+		case unicode.IsDigit(r):
+			start := idx
+			for idx < len(runes) && (unicode.IsDigit(runes[idx]) || runes[idx] == '.') {
+				idx++
+			}
+			num, err := strconv.ParseFloat(string(runes[start:idx]), 64)
+			if err != nil {
+				return nil, &ErrorFilterExpression{Position: pos, Message: fmt.Sprintf("Invalid number %q", string(runes[start:idx]))}
+			}
+			if idx < len(runes) {
+				if multiplier, ok := exprDurationUnits[unicode.ToLower(runes[idx])]; ok {
+					num *= multiplier
+					idx++
+				}
+			}
+			if idx < len(runes) && isExprIdentRune(runes[idx]) {
+				return nil, &ErrorFilterExpression{Position: pos, Message: fmt.Sprintf("Invalid number %q", string(runes[start:idx+1]))}
+			}
+			tokens = append(tokens, exprToken{kind: tokenNumber, text: string(runes[start:idx]), num: num, pos: pos})
+		case isExprIdentRune(r):
+			start := idx
+			for idx < len(runes) && isExprIdentRune(runes[idx]) {
+				idx++
+			}
+			tokens = append(tokens, exprToken{kind: tokenIdent, text: strings.ToLower(string(runes[start:idx])), pos: pos})
+		default:
+			matched := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(string(runes[idx:]), op) {
+					tokens = append(tokens, exprToken{kind: tokenOperator, text: op, pos: pos})
+					idx += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, &ErrorFilterExpression{Position: pos, Message: fmt.Sprintf("Unexpected character %q", string(r))}
+			}
+		}
+	}
+
+	return append(tokens, exprToken{kind: tokenEOF, pos: len(runes) + 1}), nil
+}
+
+func (tok exprToken) String() string {
+	if tok.kind == tokenEOF {
+		return "the end of the filter"
+	}
+
+	return strconv.Quote(tok.text)
+}
+
+func isExprIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+type exprParser struct {
+	tokens []exprToken
+	idx    int
+	fields map[string]bool
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.idx]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.idx]
+	if tok.kind != tokenEOF {
+		p.idx++
+	}
+
+	return tok
+}
+
+func (p *exprParser) peekOperator(ops ...string) (exprToken, bool) {
+	tok := p.peek()
+	if tok.kind != tokenOperator {
+		return tok, false
+	}
+
+	for _, op := range ops {
+		if tok.text == op {
+			return tok, true
+		}
+	}
+
+	return tok, false
+}
+
+func expectCondition(node exprNode, op exprToken) error {
+	if node.kind != exprBool {
+		return &ErrorFilterExpression{Position: node.pos, Message: fmt.Sprintf("%s needs a condition but found %s", op.text, node.kind)}
+	}
+
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return exprNode{}, err
+	}
+
+	for {
+		op, ok := p.peekOperator("||")
+		if !ok {
+			return left, nil
+		}
+		p.next()
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return exprNode{}, err
+		}
+		if err := expectCondition(left, op); err != nil {
+			return exprNode{}, err
+		}
+		if err := expectCondition(right, op); err != nil {
+			return exprNode{}, err
+		}
+
+		l, r := left.eval, right.eval
+		left = exprNode{kind: exprBool, pos: left.pos, eval: func(env *exprEnv) exprValue {
+			return exprValue{bool: l(env).bool || r(env).bool}
+		}}
+	}
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return exprNode{}, err
+	}
+
+	for {
+		op, ok := p.peekOperator("&&")
+		if ok {
+			p.next()
+		} else if p.startsCondition() {
+			op = exprToken{kind: tokenOperator, text: "&&", pos: p.peek().pos}
+		} else {
+			return left, nil
+		}
+
+		right, err := p.parseNot()
+		if err != nil {
+			return exprNode{}, err
+		}
+		if err := expectCondition(left, op); err != nil {
+			return exprNode{}, err
+		}
+		if err := expectCondition(right, op); err != nil {
+			return exprNode{}, err
+		}
+
+		l, r := left.eval, right.eval
+		left = exprNode{kind: exprBool, pos: left.pos, eval: func(env *exprEnv) exprValue {
+			return exprValue{bool: l(env).bool && r(env).bool}
+		}}
+	}
+}
+
+// startsCondition reports whether the next token begins another condition,
+// which is joined to the previous one with an implicit &&.
+func (p *exprParser) startsCondition() bool {
+	tok := p.peek()
+	switch tok.kind {
+	case tokenIdent, tokenNumber, tokenString:
+		return true
+	case tokenOperator:
+		return tok.text == "(" || tok.text == "!"
+	}
+
+	return false
+}
+
+// parseNot binds ! looser than comparisons so that !description ~ "tip"
+// negates the whole comparison.
+func (p *exprParser) parseNot() (exprNode, error) {
+	op, ok := p.peekOperator("!")
+	if !ok {
+		return p.parseComparison()
+	}
+	p.next()
+
+	operand, err := p.parseNot()
+	if err != nil {
+		return exprNode{}, err
+	}
+	if err := expectCondition(operand, op); err != nil {
+		return exprNode{}, err
+	}
+
+	eval := operand.eval
+	return exprNode{kind: exprBool, pos: op.pos, eval: func(env *exprEnv) exprValue {
+		return exprValue{bool: !eval(env).bool}
+	}}, nil
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return exprNode{}, err
+	}
+
+	op, ok := p.peekOperator("==", "=", "!=", "<", "<=", ">", ">=", "~", "!~")
+	if !ok {
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.parsePrimary()
+	if err != nil {
+		return exprNode{}, err
+	}
+
+	if left.kind != right.kind {
+		return exprNode{}, &ErrorFilterExpression{Position: op.pos, Message: fmt.Sprintf("Cannot compare %s with %s", left.kind, right.kind)}
+	}
+
+	compare, err := exprComparison(left.kind, op)
+	if err != nil {
+		return exprNode{}, err
+	}
+
+	l, r := left.eval, right.eval
+	return exprNode{kind: exprBool, pos: left.pos, eval: func(env *exprEnv) exprValue {
+		return exprValue{bool: compare(l(env), r(env))}
+	}}, nil
+}
+
+func exprComparison(kind exprKind, op exprToken) (func(a exprValue, b exprValue) bool, error) {
+	switch kind {
+	case exprNumber:
+		switch op.text {
+		case "==", "=":
+			return func(a exprValue, b exprValue) bool { return a.num == b.num }, nil
+		case "!=":
+			return func(a exprValue, b exprValue) bool { return a.num != b.num }, nil
+		case "<":
+			return func(a exprValue, b exprValue) bool { return a.num < b.num }, nil
+		case "<=":
+			return func(a exprValue, b exprValue) bool { return a.num <= b.num }, nil
+		case ">":
+			return func(a exprValue, b exprValue) bool { return a.num > b.num }, nil
+		case ">=":
+			return func(a exprValue, b exprValue) bool { return a.num >= b.num }, nil
+		}
+	case exprText:
+		switch op.text {
+		case "==", "=":
+			return func(a exprValue, b exprValue) bool { return strings.EqualFold(a.str, b.str) }, nil
+		case "!=":
+			return func(a exprValue, b exprValue) bool { return !strings.EqualFold(a.str, b.str) }, nil
+		case "~":
+			return func(a exprValue, b exprValue) bool {
+				return strings.Contains(strings.ToLower(a.str), strings.ToLower(b.str))
+			}, nil
+		case "!~":
+			return func(a exprValue, b exprValue) bool {
+				return !strings.Contains(strings.ToLower(a.str), strings.ToLower(b.str))
+			}, nil
+		}
+	case exprBool:
+		switch op.text {
+		case "==", "=":
+			return func(a exprValue, b exprValue) bool { return a.bool == b.bool }, nil
+		case "!=":
+			return func(a exprValue, b exprValue) bool { return a.bool != b.bool }, nil
+		}
+	}
+
+	return nil, &ErrorFilterExpression{Position: op.pos, Message: fmt.Sprintf("Cannot use %s with %s", op.text, kind)}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokenNumber:
+		value := exprValue{num: tok.num}
+		return exprNode{kind: exprNumber, pos: tok.pos, eval: func(env *exprEnv) exprValue { return value }}, nil
+	case tokenString:
+		value := exprValue{str: tok.text}
+		return exprNode{kind: exprText, pos: tok.pos, eval: func(env *exprEnv) exprValue { return value }}, nil
+	case tokenIdent:
+		if tok.text == "true" || tok.text == "false" {
+			value := exprValue{bool: tok.text == "true"}
+			return exprNode{kind: exprBool, pos: tok.pos, eval: func(env *exprEnv) exprValue { return value }}, nil
+		}
+
+		field, ok := filterExpressionFields[tok.text]
+		if !ok {
+			return exprNode{}, &ErrorFilterExpression{Position: tok.pos, Message: fmt.Sprintf("Unknown field %q, expected one of %s", tok.text, strings.Join(FilterExpressionFields(), ", "))}
+		}
+
+		p.fields[tok.text] = true
+		return exprNode{kind: field.kind, pos: tok.pos, eval: field.get}, nil
+	case tokenOperator:
+		if tok.text == "(" {
+			node, err := p.parseOr()
+			if err != nil {
+				return exprNode{}, err
+			}
+
+			closing := p.next()
+			if closing.kind != tokenOperator || closing.text != ")" {
+				return exprNode{}, &ErrorFilterExpression{Position: closing.pos, Message: fmt.Sprintf("Expected ) but found %s", closing)}
+			}
+
+			node.pos = tok.pos
+			return node, nil
+		}
+	}
+
+	return exprNode{}, &ErrorFilterExpression{Position: tok.pos, Message: fmt.Sprintf("Expected a field, number or text but found %s", tok)}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestParseFilterExpression(t *testing.T) {
+	now := time.Date(2020, 4, 18, 15, 0, 0, 0, time.UTC)
+	island := Island{
+		TurnipPrice: 512,
+		Fee:         0,
+		InQueue:     4,
+		MaxQueue:    20,
+		Category:    "turnips",
+		Islander:    "neither",
+		Hemisphere:  "north",
+		Description: "Tips appreciated, leave through the airport",
+		CreateTime:  "2020-04-18T14:00:00Z",
+	}
+
+	testTable := []struct {
+		Name          string
+		Expression    string
+		Expected      bool
+		ExpectedError *regexp.Regexp
+	}{
+		{
+			Name:       "Compares numbers",
+			Expression: "price >= 450 && fee == 0 && queue < 20",
+			Expected:   true,
+		}, {
+			Name:       "Negates a whole comparison",
+			Expression: `price >= 450 && !description ~ "tip"`,
+			Expected:   false,
+		}, {
+			Name:       "Matches text ignoring case",
+			Expression: `hemisphere == "NORTH" && category = 'turnips' && islander != "both"`,
+			Expected:   true,
+		}, {
+			Name:       "Supports not contains",
+			Expression: `description !~ "nook"`,
+			Expected:   true,
+		}, {
+			Name:       "Gives && precedence over ||",
+			Expression: "price > 600 || queue < 5 && maxqueue == 20",
+			Expected:   true,
+		}, {
+			Name:       "Groups with parentheses",
+			Expression: "(price > 600 || queue < 5) && maxqueue == 10",
+			Expected:   false,
+		}, {
+			Name:       "Measures age in minutes with units",
+			Expression: "age >= 60 && age < 2h",
+			Expected:   true,
+		}, {
+			Name:          "Reports unknown fields",
+			Expression:    "prce >= 450",
+			ExpectedError: regexp.MustCompile(`Unknown field "prce".*character 1`),
+		}, {
+			Name:          "Reports mismatched types",
+			Expression:    `price >= "high"`,
+			ExpectedError: regexp.MustCompile(`Cannot compare a number with text.*character 7`),
+		}, {
+			Name:          "Reports invalid operators",
+			Expression:    `price ~ 5`,
+			ExpectedError: regexp.MustCompile(`Cannot use ~ with a number`),
+		}, {
+			Name:          "Reports values that are not conditions",
+			Expression:    `price`,
+			ExpectedError: regexp.MustCompile(`Expected a condition`),
+		}, {
+			Name:          "Reports missing closing quotes",
+			Expression:    `description ~ "tip`,
+			ExpectedError: regexp.MustCompile(`closing quote.*character 15`),
+		}, {
+			Name:          "Reports missing closing parentheses",
+			Expression:    `(price > 5`,
+			ExpectedError: regexp.MustCompile(`Expected \)`),
+		}, {
+			Name:       "Joins adjacent conditions with &&",
+			Expression: "price>=500 queue<10 fee=0",
+			Expected:   true,
+		}, {
+			Name:       "Requires every adjacent condition",
+			Expression: "price>=500 queue>10",
+			Expected:   false,
+		}, {
+			Name:          "Reports adjacent values that are not conditions",
+			Expression:    `price > 5 queue`,
+			ExpectedError: regexp.MustCompile(`&& needs a condition but found a number.*character 11`),
+		}, {
+			Name:          "Reports trailing input",
+			Expression:    `price > 5 )`,
+			ExpectedError: regexp.MustCompile(`Unexpected "\)"`),
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			expr, err := ParseFilterExpression(tcase.Expression)
+			if tcase.ExpectedError != nil {
+				if err == nil {
+					t.Fatal("Expected an error to be returned")
+				}
+				if !tcase.ExpectedError.MatchString(err.Error()) {
+					t.Errorf("Expected error to match /%s/ but received %q", tcase.ExpectedError.String(), err.Error())
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("Expected error to be nil but received %v", err)
+			}
+
+			if expr.Match(island, now) != tcase.Expected {
+				t.Errorf("Expected %q to return %t", tcase.Expression, tcase.Expected)
+			}
+		})
+	}
+}
+
+func TestUserFilterExpressionCache(t *testing.T) {
+	tf := New()
+	user := User{ID: "foo", MaxInQueue: -1, FilterExpr: "price > 500"}
+	island := Island{TurnipPrice: 600}
+
+	if !tf.UserFilter(user)(island) {
+		t.Error("Expected the island to match the first filter")
+	}
+
+	first := tf.expressions[user.ID]
+	tf.UserFilter(user)
+	if tf.expressions[user.ID] != first {
+		t.Error("Expected the compiled filter to be reused")
+	}
+
+	user.FilterExpr = "price > 700"
+	if tf.UserFilter(user)(island) {
+		t.Error("Expected the island not to match the changed filter")
+	}
+}
@@ -1,5 +1,174 @@
 package main
 
+import (
+	"log"
+)
+
+// Filter reports whether an island should be sent.
+type Filter func(island Island) bool
+
+// AllFilters combines filters into one that only passes islands every filter
+// passes.
+func AllFilters(filters ...Filter) Filter {
+	return func(island Island) bool {
+		for _, filter := range filters {
+			if !filter(island) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+func MinPriceFilter(MinPrice int) Filter {
+	return func(island Island) bool {
+		return FilterMinPrice(island, MinPrice)
+	}
+}
+
+func MaxPriceFilter(MaxPrice int) Filter {
+	return func(island Island) bool {
+		return FilterMaxPrice(island, MaxPrice)
+	}
+}
+
+func ExcludePricesFilter(ExcludePrices []int) Filter {
+	ExcludePrices = append([]int(nil), ExcludePrices...)
+	return func(island Island) bool {
+		return FilterExcludePrices(island, ExcludePrices)
+	}
+}
+
+func QueueSizeFilter(MaxInQueue int) Filter {
+	return func(island Island) bool {
+		return FilterQueueSize(island, MaxInQueue)
+	}
+}
+
+func FeeFilter(MaxFee int) Filter {
+	return func(island Island) bool {
+		return FilterFee(island, MaxFee)
+	}
+}
+
+// ListingFilter only passes islands with one of the listings.
+func ListingFilter(listings ...Listing) Filter {
+	return func(island Island) bool {
+		for _, listing := range listings {
+			if island.Listing == listing {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// OnlyListing applies the filter to islands with the listing and passes all
+// other islands.
+func OnlyListing(listing Listing, filter Filter) Filter {
+	return func(island Island) bool {
+		return island.Listing != listing || filter(island)
+	}
+}
+
+// UserListings returns the listings a user is watching. Users watch sell
+// listings unless they have only set a buy price. A filter expression that
+// checks the listing chooses for itself, so every listing is watched.
+func UserListings(user User) []Listing {
+	if ExpressionChoosesListing(user.FilterExpr) {
+		return []Listing{ListingSell, ListingBuy}
+	}
+
+	listings := make([]Listing, 0, 2)
+	if user.SellPrice > 0 || user.BuyPrice <= 0 {
+		listings = append(listings, ListingSell)
+	}
+	if user.BuyPrice > 0 {
+		listings = append(listings, ListingBuy)
+	}
+
+	return listings
+}
+
+// ExpressionChoosesListing reports whether a filter expression refers to
+// the listing field.
+func ExpressionChoosesListing(source string) bool {
+	if source == "" {
+		return false
+	}
+
+	expr, err := ParseFilterExpression(source)
+	return err == nil && expr.UsesField("listing")
+}
+
+// UserFilters builds the filter chain for a user's settings. The sell price
+// only applies to sell listings and the buy price to Daisy Mae's buy listings.
+func UserFilters(user User) []Filter {
+	filters := []Filter{ListingFilter(UserListings(user)...)}
+
+	if user.SellPrice > 0 {
+		filters = append(filters, OnlyListing(ListingSell, MinPriceFilter(user.SellPrice)))
+	}
+	if user.BuyPrice > 0 {
+		filters = append(filters, OnlyListing(ListingBuy, MaxPriceFilter(user.BuyPrice)))
+	}
+	if len(user.ExcludePrices) > 0 {
+		filters = append(filters, ExcludePricesFilter(user.ExcludePrices))
+	}
+	if user.MaxInQueue >= 0 {
+		filters = append(filters, QueueSizeFilter(user.MaxInQueue))
+	}
+	if user.MaxFee >= 0 {
+		filters = append(filters, FeeFilter(user.MaxFee))
+	}
+
+	return filters
+}
+
+// UserFilter combines the user's settings with their filter expression. The
+// compiled expression is cached until the user changes it.
+func (tf *TurnipFinder) UserFilter(user User) Filter {
+	filters := UserFilters(user)
+
+	if user.FilterExpr != "" {
+		expr, err := tf.expression(user.ID, user.FilterExpr)
+		if err != nil {
+			log.Printf("Invalid filter for user %s: %v\n", user.ID, err)
+			return func(island Island) bool {
+				return false
+			}
+		}
+
+		filters = append(filters, expr.Filter(tf.now))
+	}
+
+	return AllFilters(filters...)
+}
+
+// expression returns the compiled expression cached under key, compiling it
+// again if the source has changed.
+func (tf *TurnipFinder) expression(key string, source string) (*FilterExpression, error) {
+	tf.mu.RLock()
+	expr, ok := tf.expressions[key]
+	tf.mu.RUnlock()
+	if ok && expr.Source == source {
+		return expr, nil
+	}
+
+	expr, err := ParseFilterExpression(source)
+	if err != nil {
+		return nil, err
+	}
+
+	tf.mu.Lock()
+	tf.expressions[key] = expr
+	tf.mu.Unlock()
+
+	return expr, nil
+}
+
 func FilterMinPrice(island Island, MinPrice int) bool {
 	if island.TurnipPrice < MinPrice {
 		return false
@@ -33,3 +202,11 @@ func FilterQueueSize(island Island, MaxInQueue int) bool {
 
 	return true
 }
+
+func FilterFee(island Island, MaxFee int) bool {
+	if island.Fee > MaxFee {
+		return false
+	}
+
+	return true
+}
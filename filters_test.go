@@ -0,0 +1,273 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUserFilters(t *testing.T) {
+	testTable := []struct {
+		Name     string
+		User     User
+		Island   Island
+		Expected bool
+	}{
+		{
+			Name:     "Passes every island without settings",
+			User:     User{MaxInQueue: -1, MaxFee: -1},
+			Island:   Island{TurnipPrice: 90, InQueue: 50, Fee: 99999},
+			Expected: true,
+		}, {
+			Name:     "Rejects islands with a fee when the user wants none",
+			User:     User{MaxInQueue: -1, MaxFee: 0},
+			Island:   Island{TurnipPrice: 600, Fee: 1},
+			Expected: false,
+		}, {
+			Name:     "Rejects islands with a fee above the maximum",
+			User:     User{MaxInQueue: -1, MaxFee: 10000},
+			Island:   Island{TurnipPrice: 600, Fee: 10001},
+			Expected: false,
+		}, {
+			Name:     "Passes islands with a fee up to the maximum",
+			User:     User{MaxInQueue: -1, MaxFee: 10000},
+			Island:   Island{TurnipPrice: 600, Fee: 10000},
+			Expected: true,
+		}, {
+			Name:     "Rejects islands below the sell price",
+			User:     User{SellPrice: 500, MaxInQueue: -1},
+			Island:   Island{TurnipPrice: 499},
+			Expected: false,
+		}, {
+			Name:     "Rejects Daisy Mae above the buy price",
+			User:     User{BuyPrice: 95, MaxInQueue: -1},
+			Island:   Island{TurnipPrice: 96, Listing: ListingBuy},
+			Expected: false,
+		}, {
+			Name:     "Passes Daisy Mae below the buy price",
+			User:     User{BuyPrice: 95, MaxInQueue: -1},
+			Island:   Island{TurnipPrice: 94, Listing: ListingBuy},
+			Expected: true,
+		}, {
+			Name:     "Rejects sell listings for buying users",
+			User:     User{BuyPrice: 95, MaxInQueue: -1},
+			Island:   Island{TurnipPrice: 90, Listing: ListingSell},
+			Expected: false,
+		}, {
+			Name:     "Rejects Daisy Mae for selling users",
+			User:     User{SellPrice: 90, MaxInQueue: -1},
+			Island:   Island{TurnipPrice: 100, Listing: ListingBuy},
+			Expected: false,
+		}, {
+			Name:     "Matches each listing against its own price",
+			User:     User{SellPrice: 500, BuyPrice: 95, MaxInQueue: -1},
+			Island:   Island{TurnipPrice: 92, Listing: ListingBuy},
+			Expected: true,
+		}, {
+			Name:     "Lets a filter expression choose the listing",
+			User:     User{FilterExpr: `listing == "buy" && price < 95`, MaxInQueue: -1},
+			Island:   Island{TurnipPrice: 90, Listing: ListingBuy},
+			Expected: true,
+		}, {
+			Name:     "Rejects excluded prices",
+			User:     User{SellPrice: 500, ExcludePrices: []int{666}, MaxInQueue: -1},
+			Island:   Island{TurnipPrice: 666},
+			Expected: false,
+		}, {
+			Name:     "Rejects islands with a long queue",
+			User:     User{SellPrice: 500, MaxInQueue: 10},
+			Island:   Island{TurnipPrice: 600, InQueue: 11},
+			Expected: false,
+		}, {
+			Name:     "Passes islands matching every setting",
+			User:     User{SellPrice: 500, ExcludePrices: []int{666}, MaxInQueue: 10},
+			Island:   Island{TurnipPrice: 600, InQueue: 10},
+			Expected: true,
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			filter := AllFilters(UserFilters(tcase.User)...)
+			if filter(tcase.Island) != tcase.Expected {
+				t.Errorf("Expected filter to return %t", tcase.Expected)
+			}
+		})
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	tf := New()
+	sent := make(map[string]int)
+	tf.SendUserMessage = func(user User, msg Message) error {
+		sent[user.ID]++
+		return nil
+	}
+
+	users := []User{
+		{ID: "high", Polling: true, SellPrice: 500, MaxInQueue: -1, NotifyOn: IslandAdded},
+		{ID: "low", Polling: true, SellPrice: 150, MaxInQueue: -1, NotifyOn: IslandAdded},
+		{ID: "queue", Polling: true, SellPrice: 100, MaxInQueue: 2, NotifyOn: IslandAdded},
+		{ID: "updates", Polling: true, SellPrice: 100, MaxInQueue: -1, NotifyOn: IslandUpdated},
+		{ID: "stopped", Polling: false, SellPrice: 100, MaxInQueue: -1, NotifyOn: IslandAdded},
+	}
+	for _, user := range users {
+		tf.SetUser(user)
+	}
+
+	events := make([]IslandEvent, 0)
+	for _, island := range testIslands(10) {
+		events = append(events, IslandEvent{Type: IslandAdded, Island: island})
+	}
+
+	err := tf.Dispatch(events)
+	if err != nil {
+		t.Fatalf("Expected error to be nil but received %v", err)
+	}
+
+	expected := map[string]int{
+		"high":    0,
+		"low":     5,
+		"queue":   3,
+		"updates": 0,
+		"stopped": 0,
+	}
+	for userID, count := range expected {
+		if sent[userID] != count {
+			t.Errorf("Expected user %s to be sent %d islands but was sent %d", userID, count, sent[userID])
+		}
+	}
+}
+
+func TestDispatchWatches(t *testing.T) {
+	tf := New()
+	sent := make(map[string][]string)
+	tf.SendUserMessage = func(user User, msg Message) error {
+		sent[user.ID] = append(sent[user.ID], msg.Text)
+		return nil
+	}
+
+	users := []User{
+		{ID: "watches", Polling: true, MaxInQueue: -1, MaxFee: -1, NotifyOn: IslandAdded, Watches: []Watch{
+			{Name: "sell-high", Expr: "price>=180", Listing: ListingSell},
+			{Name: "sell-ok", Expr: "price>=150 queue<7", Listing: ListingSell, Style: FormatCompact},
+			{Name: "paused", Expr: "price>=100", Listing: ListingSell, Paused: true},
+		}},
+		{ID: "both", Polling: true, SellPrice: 180, MaxInQueue: -1, MaxFee: -1, NotifyOn: IslandAdded, Watches: []Watch{
+			{Name: "low-queue", Expr: "queue<2", Listing: ListingSell},
+		}},
+	}
+	for _, user := range users {
+		tf.SetUser(user)
+	}
+
+	events := make([]IslandEvent, 0)
+	for _, island := range testIslands(10) {
+		events = append(events, IslandEvent{Type: IslandAdded, Island: island})
+	}
+
+	err := tf.Dispatch(events)
+	if err != nil {
+		t.Fatalf("Expected error to be nil but received %v", err)
+	}
+
+	// Islands are priced 100+10i with i in the queue.
+	expected := map[string][]string{
+		"watches": {"[sell-ok] 150 bells — ", "[sell-ok] 160 bells — ", "[sell-high] [8/", "[sell-high] [9/"},
+		"both":    {"[low-queue] [0/", "[low-queue] [1/", "[8/", "[9/"},
+	}
+	for userID, prefixes := range expected {
+		if len(sent[userID]) != len(prefixes) {
+			t.Fatalf("Expected user %s to be sent %d islands but was sent %d: %q", userID, len(prefixes), len(sent[userID]), sent[userID])
+		}
+		for idx, prefix := range prefixes {
+			if !strings.HasPrefix(sent[userID][idx], prefix) {
+				t.Errorf("Expected message %d for user %s to start with %q but received %q", idx, userID, prefix, sent[userID][idx])
+			}
+		}
+	}
+}
+
+func TestExpressionListingWatchers(t *testing.T) {
+	tf := New()
+	sent := make(map[string]int)
+	tf.SendUserMessage = func(user User, msg Message) error {
+		sent[user.ID]++
+		return nil
+	}
+
+	users := []User{
+		{ID: "expression", Polling: true, FilterExpr: `listing == "buy" && price < 95`, MaxInQueue: -1, MaxFee: -1, NotifyOn: IslandAdded},
+		{ID: "watch", Polling: true, MaxInQueue: -1, MaxFee: -1, NotifyOn: IslandAdded, Watches: []Watch{
+			{Name: "daisy", Expr: `listing == "buy" && price < 95`, Listing: ListingSell},
+		}},
+	}
+	for _, user := range users {
+		tf.SetUser(user)
+	}
+
+	query := NewSourceQuery(users)
+	if !query.WantsListing(ListingBuy) {
+		t.Errorf("Expected Daisy Mae listings to be queried but received %+v", query)
+	}
+
+	events := []IslandEvent{
+		{Type: IslandAdded, Island: Island{ID: "daisy", URL: "https://example.com/island/daisy", TurnipPrice: 90, Listing: ListingBuy}},
+		{Type: IslandAdded, Island: Island{ID: "nook", URL: "https://example.com/island/nook", TurnipPrice: 90, Listing: ListingSell}},
+	}
+	err := tf.Dispatch(events)
+	if err != nil {
+		t.Fatalf("Expected error to be nil but received %v", err)
+	}
+
+	for _, user := range users {
+		if sent[user.ID] != 1 {
+			t.Errorf("Expected user %s to be sent the Daisy Mae listing only but was sent %d islands", user.ID, sent[user.ID])
+		}
+	}
+}
+
+func TestDispatchChannels(t *testing.T) {
+	tf := New()
+	tf.SendUserMessage = func(user User, msg Message) error {
+		return nil
+	}
+	sent := make(map[string]int)
+	tf.SendChannelMessage = func(channel Channel, msg Message) error {
+		sent[channel.ID]++
+		return nil
+	}
+
+	high := NewChannel("high", "guild")
+	high.SellPrice = 170
+	low := NewChannel("low", "guild")
+	low.SellPrice = 100
+	low.FilterExpr = "queue < 3"
+	tf.SetChannel(high)
+	tf.SetChannel(low)
+	tf.SetChannel(NewChannel("inactive", "guild"))
+	tf.SetUser(User{ID: "low", Polling: true, SellPrice: 100, MaxInQueue: -1, MaxFee: -1, NotifyOn: IslandAdded})
+
+	events := make([]IslandEvent, 0)
+	for _, island := range testIslands(10) {
+		events = append(events, IslandEvent{Type: IslandAdded, Island: island})
+	}
+
+	for i := 0; i < 2; i++ {
+		err := tf.Dispatch(events)
+		if err != nil {
+			t.Fatalf("Expected error to be nil but received %v", err)
+		}
+	}
+
+	expected := map[string]int{"high": 3, "low": 3, "inactive": 0}
+	for channelID, count := range expected {
+		if sent[channelID] != count {
+			t.Errorf("Expected channel %s to be sent %d islands but was sent %d", channelID, count, sent[channelID])
+		}
+	}
+
+	history, _ := tf.History.History("low")
+	if len(history) != 10 {
+		t.Errorf("Expected the user with the channel's ID to keep their own history but found %d entries", len(history))
+	}
+}
@@ -2,4 +2,4 @@ module github.com/bmonds/turnipfinder
 
 go 1.14
 
-require github.com/bwmarrin/discordgo v0.20.3
+require github.com/bwmarrin/discordgo v0.27.1
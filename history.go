@@ -0,0 +1,41 @@
+package main
+
+import (
+	"time"
+)
+
+const defaultHistoryLimit = 100
+
+type HistoryEntry struct {
+	IslandID    string
+	Name        string
+	TurnipPrice int
+	URL         string
+	SentAt      time.Time
+}
+
+func NewHistoryEntry(island Island, sentAt time.Time) HistoryEntry {
+	return HistoryEntry{
+		IslandID:    island.ID,
+		Name:        island.Name,
+		TurnipPrice: island.TurnipPrice,
+		URL:         island.URL,
+		SentAt:      sentAt,
+	}
+}
+
+// SentIsland returns the most recent time the island was sent to the user.
+func (tf *TurnipFinder) SentIsland(userID string, islandID string) (HistoryEntry, bool, error) {
+	history, err := tf.History.History(userID)
+	if err != nil {
+		return HistoryEntry{}, false, err
+	}
+
+	for idx := len(history) - 1; idx >= 0; idx-- {
+		if history[idx].IslandID == islandID {
+			return history[idx], true, nil
+		}
+	}
+
+	return HistoryEntry{}, false, nil
+}
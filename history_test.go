@@ -0,0 +1,146 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func mockSendUserMessage(tf *TurnipFinder) *mockedReply {
+	mock := mockedReply{
+		Got: make([]string, 0),
+	}
+
+	tf.SendUserMessage = func(user User, msg Message) error {
+		mock.Add(msg.Text)
+		return nil
+	}
+
+	return &mock
+}
+
+func TestSendUserIslandEvent(t *testing.T) {
+	island := testIslands(1)[0]
+	updated := island
+	updated.TurnipPrice = 650
+	closed := island
+	closed.Closed = true
+
+	testTable := []struct {
+		Name            string
+		Events          []IslandEvent
+		ExpectedSent    int
+		ExpectedHistory int
+	}{
+		{
+			Name:            "Sends a new island",
+			Events:          []IslandEvent{{Type: IslandAdded, Island: island}},
+			ExpectedSent:    1,
+			ExpectedHistory: 1,
+		}, {
+			Name: "Does not send the same island twice",
+			Events: []IslandEvent{
+				{Type: IslandAdded, Island: island},
+				{Type: IslandAdded, Island: island},
+			},
+			ExpectedSent:    1,
+			ExpectedHistory: 1,
+		}, {
+			Name: "Sends updates to an island that was already sent",
+			Events: []IslandEvent{
+				{Type: IslandAdded, Island: island},
+				{Type: IslandUpdated, Island: updated, Previous: island},
+			},
+			ExpectedSent:    2,
+			ExpectedHistory: 2,
+		}, {
+			Name: "Reports a closed island that was sent",
+			Events: []IslandEvent{
+				{Type: IslandAdded, Island: island},
+				{Type: IslandRemoved, Island: closed, Previous: island},
+			},
+			ExpectedSent:    2,
+			ExpectedHistory: 1,
+		}, {
+			Name:            "Ignores a closed island that was never sent",
+			Events:          []IslandEvent{{Type: IslandRemoved, Island: closed, Previous: island}},
+			ExpectedSent:    0,
+			ExpectedHistory: 0,
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			tf := New()
+			mock := mockSendUserMessage(tf)
+			user, _ := tf.AddUser("foo")
+
+			for _, event := range tcase.Events {
+				err := tf.SendUserIslandEvent(user, Watch{}, event)
+				if err != nil {
+					t.Errorf("Expected error to be nil but received %v", err)
+				}
+			}
+
+			if len(mock.Got) != tcase.ExpectedSent {
+				t.Errorf("Expected %d messages but received %d", tcase.ExpectedSent, len(mock.Got))
+			}
+
+			history, _ := tf.History.History(user.ID)
+			if len(history) != tcase.ExpectedHistory {
+				t.Errorf("Expected %d history entries but found %d", tcase.ExpectedHistory, len(history))
+			}
+		})
+	}
+}
+
+func TestCommandHistory(t *testing.T) {
+	testTable := []struct {
+		Name                 string
+		Args                 string
+		Sent                 int
+		ExpectedRepliesRegex *regexp.Regexp
+	}{
+		{
+			Name:                 "Replies when nothing was sent",
+			ExpectedRepliesRegex: regexp.MustCompile(`not been sent any islands`),
+		}, {
+			Name:                 "Lists the most recent island first",
+			Sent:                 3,
+			ExpectedRepliesRegex: regexp.MustCompile(`(?s)^[^\n]*Island 2.*Island 1.*Island 0[^\n]*$`),
+		}, {
+			Name:                 "Limits the number of islands listed",
+			Args:                 "1",
+			Sent:                 3,
+			ExpectedRepliesRegex: regexp.MustCompile(`^[^\n]*Price: 120\t.*/island/2$`),
+		}, {
+			Name:                 "Shows usage for an invalid count",
+			Args:                 "none",
+			ExpectedRepliesRegex: regexp.MustCompile(`Usage: .*`),
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			tf := New()
+			tf.RegisterDefaultCommands()
+			mockSendUserMessage(tf)
+			user, _ := tf.AddUser("foo")
+			for _, island := range testIslands(tcase.Sent) {
+				tf.SendUserIsland(user, island)
+			}
+
+			mock, reply := mockReply(false)
+			err := tf.RunCommand(ChatCommandInput{Name: "history", Args: tcase.Args, User: user, Reply: reply})
+			if err != nil {
+				t.Errorf("Expected error to be nil but received %v", err)
+			}
+
+			if len(mock.Got) != 1 {
+				t.Fatalf("Expected 1 reply but received %d", len(mock.Got))
+			}
+			if !tcase.ExpectedRepliesRegex.MatchString(mock.Got[0]) {
+				t.Errorf("Expected reply to match /%s/ but received %q", tcase.ExpectedRepliesRegex.String(), mock.Got[0])
+			}
+		})
+	}
+}
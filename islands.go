@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Listing says which way turnips are traded on an island. Sell listings are
+// islands whose Nook's Cranny buys turnips. Buy listings are Daisy Mae
+// visits selling turnips.
+type Listing int
+
+const (
+	ListingSell Listing = iota
+	ListingBuy
+)
+
+func (l Listing) String() string {
+	if l == ListingBuy {
+		return "buy"
+	}
+
+	return "sell"
+}
+
+type Island struct {
+	ID          string
+	Name        string
+	TurnipPrice int
+	MaxQueue    int
+	URL         string
+	Fee         int
+	Islander    string
+	Category    string
+	Hemisphere  string
+	IslandTime  string
+	CreateTime  string // Change to date format
+	Description string
+	InQueue     int
+	Listing     Listing
+	Source      string
+	FirstSeen   time.Time
+	LastSeen    time.Time
+	Closed      bool
+	ClosedAt    time.Time
+}
+
+// IslandEventType values are bit flags so a set of them can be stored as a
+// single User.NotifyOn value.
+type IslandEventType int
+
+const (
+	IslandAdded IslandEventType = 1 << iota
+	IslandUpdated
+	IslandRemoved
+
+	IslandUnchanged IslandEventType = 0
+)
+
+var islandEventNames = map[IslandEventType]string{
+	IslandAdded:   "added",
+	IslandUpdated: "updated",
+	IslandRemoved: "removed",
+}
+
+func (t IslandEventType) String() string {
+	if t == IslandUnchanged {
+		return "unchanged"
+	}
+
+	names := make([]string, 0)
+	for _, eventType := range []IslandEventType{IslandAdded, IslandUpdated, IslandRemoved} {
+		if t&eventType != 0 {
+			names = append(names, islandEventNames[eventType])
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func ParseIslandEventType(name string) (IslandEventType, bool) {
+	for eventType, eventName := range islandEventNames {
+		if strings.EqualFold(name, eventName) {
+			return eventType, true
+		}
+	}
+
+	return IslandUnchanged, false
+}
+
+type IslandEvent struct {
+	Type     IslandEventType
+	Island   Island
+	Previous Island
+}
+
+func ValidateIsland(island Island) error {
+	if island.ID == "" {
+		return errors.New("Island must have ID")
+	} else if island.URL == "" {
+		return errors.New("Island must have URL")
+	}
+
+	return nil
+}
+
+// IslandChanged reports whether anything a user would be notified about
+// differs between two polls of the same island.
+func IslandChanged(previous Island, island Island) bool {
+	return previous.TurnipPrice != island.TurnipPrice ||
+		previous.InQueue != island.InQueue ||
+		previous.MaxQueue != island.MaxQueue ||
+		previous.Fee != island.Fee ||
+		previous.Description != island.Description
+}
+
+// AddIsland stores the island and reports whether it is new, has changed
+// since it was last added or is unchanged. A closed island that is added
+// again is reported as new.
+func (tf *TurnipFinder) AddIsland(island Island) (IslandEvent, error) {
+	err := ValidateIsland(island)
+	if err != nil {
+		return IslandEvent{}, err
+	}
+
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+
+	return tf.addIsland(island), nil
+}
+
+func (tf *TurnipFinder) addIsland(island Island) IslandEvent {
+	now := tf.now()
+	previous, ok := tf.islands[island.ID]
+	if ok && !previous.Closed {
+		island.FirstSeen = previous.FirstSeen
+	} else {
+		island.FirstSeen = now
+	}
+	island.LastSeen = now
+	island.Closed = false
+	island.ClosedAt = time.Time{}
+	tf.islands[island.ID] = island
+
+	if !ok || previous.Closed {
+		return IslandEvent{Type: IslandAdded, Island: island}
+	} else if IslandChanged(previous, island) {
+		return IslandEvent{Type: IslandUpdated, Island: island, Previous: previous}
+	}
+
+	return IslandEvent{Type: IslandUnchanged, Island: island, Previous: previous}
+}
+
+func (tf *TurnipFinder) closeIsland(ID string) IslandEvent {
+	island := tf.islands[ID]
+	previous := island
+	island.Closed = true
+	island.ClosedAt = tf.now()
+	tf.islands[ID] = island
+
+	return IslandEvent{Type: IslandRemoved, Island: island, Previous: previous}
+}
+
+// pruneIslands forgets closed islands once Config.IslandRetention has passed.
+func (tf *TurnipFinder) pruneIslands() {
+	cutoff := tf.now().Add(-tf.Config.IslandRetention)
+	for ID, island := range tf.islands {
+		if island.Closed && island.ClosedAt.Before(cutoff) {
+			delete(tf.islands, ID)
+		}
+	}
+}
+
+// mergeSourceIslands applies a result from one source. Islands the source has
+// not returned for Config.IslandCloseGrace are marked closed, unless they are
+// outside what the source fetched. A nil coverage is a complete result.
+func (tf *TurnipFinder) mergeSourceIslands(source string, islands []Island, covered IslandCoverage) []IslandEvent {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+
+	events := make([]IslandEvent, 0)
+	seen := make(map[string]bool, len(islands))
+	for _, island := range islands {
+		island.Source = source
+		seen[island.ID] = true
+
+		event := tf.addIsland(island)
+		if event.Type != IslandUnchanged {
+			events = append(events, event)
+		}
+	}
+
+	cutoff := tf.now().Add(-tf.Config.IslandCloseGrace)
+	for ID, island := range tf.islands {
+		if island.Source != source || seen[ID] || island.Closed || island.LastSeen.After(cutoff) {
+			continue
+		}
+		if covered == nil || covered(island) {
+			events = append(events, tf.closeIsland(ID))
+		}
+	}
+
+	tf.pruneIslands()
+
+	return events
+}
+
+func (tf *TurnipFinder) Island(ID string) (Island, bool) {
+	tf.mu.RLock()
+	defer tf.mu.RUnlock()
+
+	island, ok := tf.islands[ID]
+	return island, ok
+}
+
+// Islands returns every island being tracked, including closed islands that
+// have not been pruned yet.
+func (tf *TurnipFinder) Islands() []Island {
+	tf.mu.RLock()
+	defer tf.mu.RUnlock()
+
+	islands := make([]Island, 0, len(tf.islands))
+	for _, island := range tf.islands {
+		islands = append(islands, island)
+	}
+
+	return islands
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPollSourcesEvents(t *testing.T) {
+	changed := testIslands(3)
+	changed[0].TurnipPrice = 600
+	changed[1].InQueue = 15
+
+	testTable := []struct {
+		Name            string
+		Polls           [][]Island
+		Advance         time.Duration
+		ExpectedEvents  map[string]IslandEventType
+		ExpectedIslands int
+	}{
+		{
+			Name:  "New islands are added",
+			Polls: [][]Island{testIslands(2)},
+			ExpectedEvents: map[string]IslandEventType{
+				"island0": IslandAdded,
+				"island1": IslandAdded,
+			},
+			ExpectedIslands: 2,
+		}, {
+			Name:            "Unchanged islands produce no events",
+			Polls:           [][]Island{testIslands(2), testIslands(2)},
+			ExpectedEvents:  map[string]IslandEventType{},
+			ExpectedIslands: 2,
+		}, {
+			Name:  "Changed islands are updated",
+			Polls: [][]Island{testIslands(3), changed},
+			ExpectedEvents: map[string]IslandEventType{
+				"island0": IslandUpdated,
+				"island1": IslandUpdated,
+			},
+			ExpectedIslands: 3,
+		}, {
+			Name:            "Missing islands stay open during the grace period",
+			Polls:           [][]Island{testIslands(3), testIslands(1)},
+			Advance:         time.Minute,
+			ExpectedEvents:  map[string]IslandEventType{},
+			ExpectedIslands: 3,
+		}, {
+			Name:    "Missing islands are closed after the grace period",
+			Polls:   [][]Island{testIslands(3), testIslands(1)},
+			Advance: 10 * time.Minute,
+			ExpectedEvents: map[string]IslandEventType{
+				"island1": IslandRemoved,
+				"island2": IslandRemoved,
+			},
+			ExpectedIslands: 3,
+		}, {
+			Name:    "Closed islands that return are added again",
+			Polls:   [][]Island{testIslands(3), testIslands(1), testIslands(2)},
+			Advance: 10 * time.Minute,
+			ExpectedEvents: map[string]IslandEventType{
+				"island1": IslandAdded,
+			},
+			ExpectedIslands: 3,
+		}, {
+			Name:            "Closed islands are pruned after the retention period",
+			Polls:           [][]Island{testIslands(3), testIslands(1), testIslands(1)},
+			Advance:         2 * time.Hour,
+			ExpectedEvents:  map[string]IslandEventType{},
+			ExpectedIslands: 1,
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			clock := newTestClock(time.Date(2020, 4, 18, 12, 0, 0, 0, time.UTC))
+			tf := New()
+			tf.Clock = clock
+			source := &staticSource{}
+			tf.AddSource(source)
+
+			var events []IslandEvent
+			for _, islands := range tcase.Polls {
+				clock.Advance(tcase.Advance)
+				source.islands = islands
+				events = tf.PollSources(context.Background())
+			}
+
+			if len(tf.Islands()) != tcase.ExpectedIslands {
+				t.Errorf("Expected %d islands to be tracked but found %d", tcase.ExpectedIslands, len(tf.Islands()))
+			}
+
+			if len(events) != len(tcase.ExpectedEvents) {
+				t.Errorf("Expected %d events but received %d", len(tcase.ExpectedEvents), len(events))
+			}
+
+			for _, event := range events {
+				expected, ok := tcase.ExpectedEvents[event.Island.ID]
+				if !ok {
+					t.Errorf("Received an unexpected %s event for %s", event.Type, event.Island.ID)
+				} else if event.Type != expected {
+					t.Errorf("Expected %s to be %s but received %s", event.Island.ID, expected, event.Type)
+				}
+			}
+		})
+	}
+}
+
+// partialSource covers only the listings it is given.
+type partialSource struct {
+	staticSource
+	listings []Listing
+}
+
+func (s *partialSource) RunPartial(ctx context.Context) ([]Island, IslandCoverage, error) {
+	covered := func(island Island) bool {
+		for _, listing := range s.listings {
+			if island.Listing == listing {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return s.islands, covered, nil
+}
+
+func TestPollSourcesPartialResults(t *testing.T) {
+	clock := newTestClock(time.Date(2020, 4, 18, 12, 0, 0, 0, time.UTC))
+	tf := New()
+	tf.Clock = clock
+
+	islands := testIslands(3)
+	islands[2].Listing = ListingBuy
+	source := &partialSource{staticSource: staticSource{islands: islands}, listings: []Listing{ListingSell, ListingBuy}}
+	tf.AddSource(source)
+	tf.PollSources(context.Background())
+
+	clock.Advance(10 * time.Minute)
+	source.islands = islands[:1]
+	source.listings = []Listing{ListingSell}
+	events := tf.PollSources(context.Background())
+
+	if len(events) != 1 || events[0].Type != IslandRemoved || events[0].Island.ID != "island1" {
+		t.Errorf("Expected only island1 to be closed but received %+v", events)
+	}
+	if island, _ := tf.Island("island2"); island.Closed {
+		t.Error("Expected the buy listing that was not fetched to stay open")
+	}
+}
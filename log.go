@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelOff   = "off"
+)
+
+// debugLog is for chatty output, like every island found, which is only
+// written at the debug level.
+var debugLog = log.New(ioutil.Discard, "", log.LstdFlags)
+
+func ValidateLogLevel(level string) error {
+	switch level {
+	case LogLevelDebug, LogLevelInfo, LogLevelOff:
+		return nil
+	}
+
+	return fmt.Errorf("Unknown log level %q, choose from debug, info or off", level)
+}
+
+// SetLogLevel configures the standard logger and debugLog for a level.
+func SetLogLevel(level string) error {
+	err := ValidateLogLevel(level)
+	if err != nil {
+		return err
+	}
+
+	log.SetOutput(os.Stderr)
+	debugLog.SetOutput(ioutil.Discard)
+	switch level {
+	case LogLevelDebug:
+		debugLog.SetOutput(os.Stderr)
+	case LogLevelOff:
+		log.SetOutput(ioutil.Discard)
+	}
+
+	return nil
+}
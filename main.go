@@ -1,77 +1,179 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"net"
+	"net/smtp"
 	"os"
-	"time"
+	"os/signal"
+	"syscall"
 )
 
-// TODO: Get rid of this loop. Move notifications and filters to module code instead of app code.
-func loop(config *AppConfig, tf *TurnipFinder) {
-	islands := make([]Island, 0)
+// shutdownContext returns a context that is cancelled on SIGINT or SIGTERM. A
+// second signal exits straight away, in case shutting down hangs.
+func shutdownContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
 
-	for {
-		newIslands := make([]Island, 0)
-		pollingUsers := tf.PollingUsers()
-		if len(pollingUsers) > 0 {
-			newIslands = tf.PollSources()
-		}
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("Received %s, shutting down\n", sig)
+		cancel()
 
-		if len(newIslands) > 0 {
-			for _, island := range newIslands {
-
-				islands = append(islands, island)
-				log.Printf("[%d/%d] %s \tPrice: %d\tURL: %s\n", island.InQueue, island.MaxQueue, island.Name, island.TurnipPrice, island.URL)
-
-				for _, user := range pollingUsers {
-					if user.SellPrice > 0 && !FilterMinPrice(island, user.SellPrice) {
-						break
-					}
-					if user.BuyPrice > 0 && !FilterMaxPrice(island, user.BuyPrice) {
-						// TODO: Buying must also check for Daisy
-						break
-					}
-					if len(user.ExcludePrices) > 0 && !FilterExcludePrices(island, user.ExcludePrices) {
-						break
-					}
-					if user.MaxInQueue >= 0 && !FilterQueueSize(island, user.MaxInQueue) {
-						break
-					}
-
-					err := tf.SendUserIsland(user, island)
-					if err != nil {
-						log.Println("Error sending island message")
-						log.Fatal(err)
-					}
-				}
-			}
+		<-signals
+		os.Exit(1)
+	}()
+
+	return ctx, cancel
+}
+
+// runCLI reads commands from stdin and prints islands to stdout, polling
+// sources until stdin is closed or the process is told to stop. It is used
+// when no chat transport is configured.
+func runCLI(ctx context.Context, stop context.CancelFunc, tf *TurnipFinder) error {
+	log.Println("No Discord, Telegram or Slack token given, reading commands from stdin. Send help for a list of commands.")
+
+	cli := NewCLI(os.Stdin, os.Stdout)
+	cli.Color = isTerminal(os.Stdout) && os.Getenv("NO_COLOR") == ""
+	tf.AddNotifier(NotifierCLI, cli)
 
+	go func() {
+		err := cli.Run(ctx, tf)
+		if err != nil && err != context.Canceled {
+			log.Println(err)
 		}
+		stop()
+	}()
 
-		time.Sleep(config.LoopInterval * time.Second)
-	}
+	return tf.Run(ctx)
 }
 
 // TODO: Move main package to sub folder, for app, and change this package to turnipfinder.
 func main() {
-	// TODO: Check args & env variable. Store config and user state.
-	config := NewConfig(os.Args[1])
+	config, request, err := LoadConfig(os.Args[1:], os.Getenv, os.Stderr)
+	if err == flag.ErrHelp {
+		return
+	} else if err != nil {
+		log.Fatal(err)
+	}
 
-	tf := New()
-	tf.AddSource(NewTurnipExchangeSource())
+	if request.PrintConfig {
+		data, err := config.Redacted()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(data))
+		return
+	}
 
-	dg, err := DiscordConnect(config.DiscordBotToken)
+	err = SetLogLevel(config.LogLevel)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	defer dg.Close()
+	ctx, stop := shutdownContext()
+	defer stop()
+
+	tf := New()
+	tf.Config.PollInterval = config.LoopInterval
+	tf.MinTurnipPriceAllowed = config.MinTurnipPriceAllowed
+	tf.MaxTurnipPriceAllowed = config.MaxTurnipPriceAllowed
+
+	if config.StorePath != "" {
+		store, err := NewFileStore(config.StorePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		tf.Users = store
+		tf.History = store
+		tf.Channels = store
+	}
 
+	for _, name := range config.Sources {
+		source, err := NewSource(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tf.AddSource(source)
+	}
 	tf.RegisterDefaultCommands()
 
-	tf.SendUserMessage = DiscordSendUserMessageWrapper(dg)
+	if config.DiscordBotToken == "" && config.TelegramBotToken == "" && config.SlackBotToken == "" {
+		err = runCLI(ctx, stop, tf)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	dg.AddHandler(DiscordCreateMessageWrapper(tf))
+	tf.AddNotifier(NotifierWebhook, NewWebhookNotifier())
+	if config.SMTPAddr != "" {
+		var auth smtp.Auth
+		if config.SMTPUsername != "" {
+			host, _, _ := net.SplitHostPort(config.SMTPAddr)
+			auth = smtp.PlainAuth("", config.SMTPUsername, config.SMTPPassword, host)
+		}
+		tf.AddNotifier(NotifierEmail, NewEmailNotifier(config.SMTPAddr, config.SMTPFrom, auth))
+	}
+
+	if config.DiscordBotToken != "" {
+		dg, err := DiscordConnect(config.DiscordBotToken)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	loop(config, tf)
+		tf.AddNotifier(NotifierDiscord, NewDiscordNotifier(dg))
+		tf.DefaultNotifier = NotifierDiscord
+		tf.SendChannelMessage = DiscordSendChannelMessageWrapper(dg)
+
+		dg.AddHandler(DiscordCreateMessageWrapper(tf))
+		dg.AddHandler(DiscordInteractionCreateWrapper(tf))
+
+		err = DiscordRegisterCommands(dg, tf, config.DiscordGuildID)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	if config.SlackBotToken != "" {
+		app := NewSlackApp(config.SlackBotToken, config.SlackSigningSecret)
+		if config.SlackBaseURL != "" {
+			app.BaseURL = config.SlackBaseURL
+		}
+		tf.AddNotifier(NotifierSlack, app)
+
+		go func() {
+			err := app.ListenAndServe(config.SlackListenAddr, tf)
+			if err != nil {
+				log.Println(err)
+			}
+		}()
+	}
+
+	if config.TelegramBotToken != "" {
+		bot := NewTelegramBot(config.TelegramBotToken)
+		if config.TelegramBaseURL != "" {
+			bot.BaseURL = config.TelegramBaseURL
+		}
+		tf.AddNotifier(NotifierTelegram, bot)
+
+		go func() {
+			err := bot.Run(ctx, tf)
+			if err != nil && err != context.Canceled {
+				log.Println(err)
+			}
+		}()
+	}
+
+	// Run closes the Discord session and the Slack server with the other
+	// notifiers once ctx is cancelled.
+	err = tf.Run(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
 }
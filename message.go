@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	queueBarWidth = 10
+
+	colorClosed = 0x95A5A6
+)
+
+// Message is a notification with optional rich content. Text always holds the
+// whole message so transports without embeds can send it as it is.
+type Message struct {
+	Text  string
+	Embed *MessageEmbed
+}
+
+// MessageEmbed is a transport neutral card. Link adds a button opening URL.
+type MessageEmbed struct {
+	Title       string
+	URL         string
+	Description string
+	Color       int
+	Fields      []MessageField
+	Footer      string
+	Link        string
+}
+
+type MessageField struct {
+	Name   string
+	Value  string
+	Inline bool
+}
+
+func TextMessage(text string) Message {
+	return Message{Text: text}
+}
+
+// priceTier colours an island by how good its price is. Tiers are checked in
+// order and the first one the price reaches is used.
+type priceTier struct {
+	Price int
+	Color int
+}
+
+var sellPriceTiers = []priceTier{
+	{Price: 600, Color: 0x9B59B6},
+	{Price: 450, Color: 0x2ECC71},
+	{Price: 300, Color: 0xF1C40F},
+	{Price: 0, Color: colorClosed},
+}
+
+// Daisy Mae is better the lower her price, so buy tiers are upper bounds.
+var buyPriceTiers = []priceTier{
+	{Price: 92, Color: 0x2ECC71},
+	{Price: 100, Color: 0xF1C40F},
+}
+
+// PriceColor returns the colour for the island's price tier.
+func PriceColor(island Island) int {
+	if island.Listing == ListingBuy {
+		for _, tier := range buyPriceTiers {
+			if island.TurnipPrice <= tier.Price {
+				return tier.Color
+			}
+		}
+
+		return colorClosed
+	}
+
+	for _, tier := range sellPriceTiers {
+		if island.TurnipPrice >= tier.Price {
+			return tier.Color
+		}
+	}
+
+	return colorClosed
+}
+
+// QueueBar draws how full the island's queue is, for example ▰▰▱▱▱▱▱▱▱▱ 4/20.
+func QueueBar(inQueue int, maxQueue int) string {
+	if inQueue < 0 || maxQueue <= 0 {
+		return "unknown"
+	}
+
+	filled := (inQueue*queueBarWidth + maxQueue/2) / maxQueue
+	if filled > queueBarWidth {
+		filled = queueBarWidth
+	}
+
+	return fmt.Sprintf("%s%s %d/%d", strings.Repeat("▰", filled), strings.Repeat("▱", queueBarWidth-filled), inQueue, maxQueue)
+}
+
+// RenderIslandEmbed renders the embed sent with the full format. The prefix,
+// such as "Updated: ", starts the title.
+func RenderIslandEmbed(island Island, prefix string) *MessageEmbed {
+	priceName := "Buying turnips for"
+	if island.Listing == ListingBuy {
+		priceName = "Daisy Mae sells for"
+	}
+
+	embed := &MessageEmbed{
+		Title:       prefix + island.Name,
+		URL:         island.URL,
+		Description: island.Description,
+		Color:       PriceColor(island),
+		Fields: []MessageField{
+			{Name: priceName, Value: fmt.Sprintf("**%d** bells", island.TurnipPrice), Inline: true},
+			{Name: "Queue", Value: QueueBar(island.InQueue, island.MaxQueue), Inline: true},
+			{Name: "Fee", Value: renderFee(island.Fee), Inline: true},
+		},
+		Footer: island.Source,
+		Link:   island.URL,
+	}
+
+	if island.Islander != "" {
+		embed.Fields = append(embed.Fields, MessageField{Name: "Islander", Value: island.Islander, Inline: true})
+	}
+	if island.Category != "" {
+		embed.Fields = append(embed.Fields, MessageField{Name: "Category", Value: island.Category, Inline: true})
+	}
+
+	return embed
+}
+
+// RenderClosedIslandMessage renders the notice for an island that closed.
+func RenderClosedIslandMessage(island Island, watch Watch) Message {
+	prefix := watchPrefix(watch)
+
+	return Message{
+		Text: fmt.Sprintf("%sClosed: %s is no longer listed\nURL: %s\n", prefix, island.Name, island.URL),
+		Embed: &MessageEmbed{
+			Title:       fmt.Sprintf("%sClosed: %s", prefix, island.Name),
+			URL:         island.URL,
+			Description: "This island is no longer listed.",
+			Color:       colorClosed,
+		},
+	}
+}
+
+func watchPrefix(watch Watch) string {
+	if watch.Name == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("[%s] ", watch.Name)
+}
+
+// truncateText shortens s to at most length characters, ending it with an
+// ellipsis if anything was cut. Negative lengths leave s as it is.
+func truncateText(s string, length int) string {
+	runes := []rune(s)
+	if length < 0 || len(runes) <= length {
+		return s
+	}
+	if length == 0 {
+		return ""
+	}
+
+	return string(runes[:length-1]) + "…"
+}
+
+func renderFee(fee int) string {
+	if fee <= 0 {
+		return "None"
+	}
+
+	return strconv.Itoa(fee)
+}
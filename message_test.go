@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestQueueBar(t *testing.T) {
+	testTable := []struct {
+		InQueue  int
+		MaxQueue int
+		Expected string
+	}{
+		{InQueue: 0, MaxQueue: 20, Expected: "▱▱▱▱▱▱▱▱▱▱ 0/20"},
+		{InQueue: 5, MaxQueue: 20, Expected: "▰▰▰▱▱▱▱▱▱▱ 5/20"},
+		{InQueue: 25, MaxQueue: 20, Expected: "▰▰▰▰▰▰▰▰▰▰ 25/20"},
+		{InQueue: -1, MaxQueue: 20, Expected: "unknown"},
+		{InQueue: 3, MaxQueue: 0, Expected: "unknown"},
+	}
+
+	for _, tcase := range testTable {
+		if bar := QueueBar(tcase.InQueue, tcase.MaxQueue); bar != tcase.Expected {
+			t.Errorf("Expected %d/%d to draw %q but received %q", tcase.InQueue, tcase.MaxQueue, tcase.Expected, bar)
+		}
+	}
+}
+
+func TestPriceColor(t *testing.T) {
+	testTable := []struct {
+		Name     string
+		Island   Island
+		Expected int
+	}{
+		{Name: "Colours the best sell prices", Island: Island{TurnipPrice: 650}, Expected: 0x9B59B6},
+		{Name: "Colours good sell prices", Island: Island{TurnipPrice: 450}, Expected: 0x2ECC71},
+		{Name: "Colours low sell prices grey", Island: Island{TurnipPrice: 120}, Expected: colorClosed},
+		{Name: "Colours cheap Daisy Mae prices", Island: Island{TurnipPrice: 90, Listing: ListingBuy}, Expected: 0x2ECC71},
+		{Name: "Colours expensive Daisy Mae prices grey", Island: Island{TurnipPrice: 108, Listing: ListingBuy}, Expected: colorClosed},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			if color := PriceColor(tcase.Island); color != tcase.Expected {
+				t.Errorf("Expected colour %06x but received %06x", tcase.Expected, color)
+			}
+		})
+	}
+}
+
+func TestRenderIslandEmbed(t *testing.T) {
+	island := Island{
+		Name:        "Nook",
+		TurnipPrice: 512,
+		InQueue:     4,
+		MaxQueue:    20,
+		URL:         "https://example.com/island/1",
+		Islander:    "neither",
+		Category:    "turnips",
+		Description: "Tips appreciated",
+	}
+
+	embed := RenderIslandEmbed(island, "[sell-high] Updated: ")
+	if embed.Title != "[sell-high] Updated: Nook" || embed.Link != island.URL || embed.Description != island.Description {
+		t.Errorf("Unexpected embed %+v", embed)
+	}
+	if len(embed.Fields) != 5 || embed.Fields[0].Value != "**512** bells" || embed.Fields[2].Value != "None" {
+		t.Errorf("Unexpected fields %+v", embed.Fields)
+	}
+
+	island.Islander = ""
+	island.Category = ""
+	if fields := RenderIslandEmbed(island, "").Fields; len(fields) != 3 {
+		t.Errorf("Expected empty details to be left out but received %+v", fields)
+	}
+}
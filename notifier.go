@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	NotifierDiscord  = "discord"
+	NotifierWebhook  = "webhook"
+	NotifierEmail    = "email"
+	NotifierTelegram = "telegram"
+)
+
+const (
+	confirmationExpiry      = time.Hour
+	confirmationResend      = time.Minute
+	maxConfirmationAttempts = 5
+)
+
+// Notifier delivers messages over one transport. The recipient is an address
+// the transport understands, such as a Discord user ID, a webhook URL or an
+// email address.
+type Notifier interface {
+	Send(ctx context.Context, recipient string, message Message) error
+	Capabilities() NotifierCapabilities
+}
+
+// RecipientValidator is implemented by notifiers that can check an address
+// before a user saves it.
+type RecipientValidator interface {
+	ValidateRecipient(recipient string) error
+}
+
+// RecipientConfirmer is implemented by notifiers that reach third parties.
+// The recipient is sent a code, and the user must send it back before the
+// target is saved.
+type RecipientConfirmer interface {
+	SendConfirmation(ctx context.Context, recipient string, code string) error
+}
+
+type NotifierCapabilities struct {
+	// Embeds is true if the transport can show a MessageEmbed. Embeds are
+	// dropped for transports that cannot.
+	Embeds bool
+	// MaxLength limits the length of Text in characters. Zero is no limit.
+	MaxLength int
+}
+
+// Adapt fits a message to what the transport can show.
+func (c NotifierCapabilities) Adapt(message Message) Message {
+	if !c.Embeds {
+		message.Embed = nil
+	}
+	if c.MaxLength > 0 {
+		message.Text = truncateText(message.Text, c.MaxLength)
+	}
+
+	return message
+}
+
+// NotifyTarget is one place a user is sent islands.
+type NotifyTarget struct {
+	Notifier  string
+	Recipient string
+}
+
+func (t NotifyTarget) String() string {
+	return fmt.Sprintf("%s: %s", t.Notifier, t.Recipient)
+}
+
+type ErrorNotifierNotFound struct {
+	Name string
+}
+
+func (e *ErrorNotifierNotFound) Error() string {
+	return fmt.Sprintf("Notifier %s was not found", e.Name)
+}
+
+// ErrorNotifyFailed is returned when a message could not be delivered to any
+// of a user's targets.
+type ErrorNotifyFailed struct {
+	UserID string
+	Errors []error
+}
+
+func (e *ErrorNotifyFailed) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+
+	return fmt.Sprintf("Could not notify user %s: %s", e.UserID, strings.Join(msgs, "; "))
+}
+
+// AddNotifier makes a transport available to users under name.
+func (tf *TurnipFinder) AddNotifier(name string, notifier Notifier) {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+
+	tf.notifiers[name] = notifier
+}
+
+func (tf *TurnipFinder) Notifier(name string) (Notifier, error) {
+	tf.mu.RLock()
+	defer tf.mu.RUnlock()
+
+	notifier, ok := tf.notifiers[name]
+	if !ok {
+		return nil, &ErrorNotifierNotFound{Name: name}
+	}
+
+	return notifier, nil
+}
+
+// NotifierNames returns the names of the available notifiers, sorted.
+func (tf *TurnipFinder) NotifierNames() []string {
+	tf.mu.RLock()
+	defer tf.mu.RUnlock()
+
+	names := make([]string, 0, len(tf.notifiers))
+	for name := range tf.notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// NotifyTargets returns where the user is sent islands. Users who have not
+// chosen are sent them by the transport they signed up with.
+func (tf *TurnipFinder) NotifyTargets(user User) []NotifyTarget {
+	if len(user.NotifyVia) > 0 {
+		return user.NotifyVia
+	}
+
+	target, ok := tf.defaultNotifyTarget(user)
+	if !ok {
+		return nil
+	}
+
+	return []NotifyTarget{target}
+}
+
+// defaultNotifyTarget is the user's own account on the transport in their
+// ID, or on DefaultNotifier for IDs without one.
+func (tf *TurnipFinder) defaultNotifyTarget(user User) (NotifyTarget, bool) {
+	transport, accountID := SplitUserID(user.ID)
+	if transport == "" {
+		transport = tf.DefaultNotifier
+	}
+	if transport == "" {
+		return NotifyTarget{}, false
+	}
+
+	return NotifyTarget{Notifier: transport, Recipient: accountID}, true
+}
+
+// NotifyUser sends a message to all of the user's targets at once. It only
+// fails if no target could be reached, so one broken webhook does not stop
+// the user being sent islands elsewhere.
+func (tf *TurnipFinder) NotifyUser(user User, message Message) error {
+	targets := tf.NotifyTargets(user)
+	if len(targets) == 0 {
+		return &ErrorNotifyFailed{UserID: user.ID, Errors: []error{fmt.Errorf("User has nowhere to be sent messages")}}
+	}
+
+	errs := make([]error, len(targets))
+	var wg sync.WaitGroup
+	for idx, target := range targets {
+		wg.Add(1)
+		go func(idx int, target NotifyTarget) {
+			defer wg.Done()
+			errs[idx] = tf.notify(target, message)
+		}(idx, target)
+	}
+	wg.Wait()
+
+	failed := make([]error, 0)
+	for idx, err := range errs {
+		if err != nil {
+			log.Printf("Error notifying user %s by %s: %v\n", user.ID, targets[idx].Notifier, err)
+			failed = append(failed, err)
+		}
+	}
+
+	if len(failed) == len(targets) {
+		return &ErrorNotifyFailed{UserID: user.ID, Errors: failed}
+	}
+
+	return nil
+}
+
+func (tf *TurnipFinder) notify(target NotifyTarget, message Message) error {
+	notifier, err := tf.Notifier(target.Notifier)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tf.Config.NotifyTimeout)
+	defer cancel()
+
+	return notifier.Send(ctx, target.Recipient, notifier.Capabilities().Adapt(message))
+}
+
+type ErrorConfirmationRecent struct {
+	RetryAfter time.Duration
+}
+
+func (e *ErrorConfirmationRecent) Error() string {
+	return fmt.Sprintf("A confirmation code was sent recently. Try again in %s", e.RetryAfter.Round(time.Second))
+}
+
+// pendingTarget is a notify target waiting for its confirmation code.
+type pendingTarget struct {
+	Target   NotifyTarget
+	Code     string
+	SentAt   time.Time
+	Attempts int
+}
+
+// SendConfirmation sends the recipient a code which ConfirmNotifyTarget takes
+// to save the target. Each user has one code at a time and may only ask for a
+// new one every confirmationResend, so the bot cannot be used to flood an
+// address.
+func (tf *TurnipFinder) SendConfirmation(user User, target NotifyTarget, confirmer RecipientConfirmer) error {
+	code, err := newConfirmationCode()
+	if err != nil {
+		return err
+	}
+
+	now := tf.now()
+	tf.mu.Lock()
+	pending, ok := tf.confirmations[user.ID]
+	if ok && now.Sub(pending.SentAt) < confirmationResend {
+		tf.mu.Unlock()
+		return &ErrorConfirmationRecent{RetryAfter: confirmationResend - now.Sub(pending.SentAt)}
+	}
+	tf.confirmations[user.ID] = pendingTarget{Target: target, Code: code, SentAt: now}
+	tf.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), tf.Config.NotifyTimeout)
+	defer cancel()
+
+	return confirmer.SendConfirmation(ctx, target.Recipient, code)
+}
+
+// ConfirmNotifyTarget returns the target waiting for code. The code is
+// forgotten once it is used, expires or has been guessed wrong
+// maxConfirmationAttempts times.
+func (tf *TurnipFinder) ConfirmNotifyTarget(user User, notifier string, code string) (NotifyTarget, error) {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+
+	pending, ok := tf.confirmations[user.ID]
+	if !ok || pending.Target.Notifier != notifier || tf.now().Sub(pending.SentAt) > confirmationExpiry {
+		delete(tf.confirmations, user.ID)
+		return NotifyTarget{}, fmt.Errorf("There is no %s waiting to be confirmed. Add it again for a new code", notifier)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(pending.Code), []byte(strings.TrimSpace(code))) != 1 {
+		pending.Attempts++
+		if pending.Attempts >= maxConfirmationAttempts {
+			delete(tf.confirmations, user.ID)
+			return NotifyTarget{}, fmt.Errorf("That code is wrong. Add the %s again for a new code", notifier)
+		}
+		tf.confirmations[user.ID] = pending
+		return NotifyTarget{}, fmt.Errorf("That code is wrong")
+	}
+
+	delete(tf.confirmations, user.ID)
+	return pending.Target, nil
+}
+
+func newConfirmationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
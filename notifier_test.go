@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+type mockNotifier struct {
+	mu           sync.Mutex
+	capabilities NotifierCapabilities
+	err          error
+	sent         map[string][]Message
+}
+
+func newMockNotifier(capabilities NotifierCapabilities, err error) *mockNotifier {
+	return &mockNotifier{capabilities: capabilities, err: err, sent: make(map[string][]Message)}
+}
+
+func (n *mockNotifier) Send(ctx context.Context, recipient string, message Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.err != nil {
+		return n.err
+	}
+	n.sent[recipient] = append(n.sent[recipient], message)
+	return nil
+}
+
+func (n *mockNotifier) Capabilities() NotifierCapabilities {
+	return n.capabilities
+}
+
+func TestNotifierCapabilitiesAdapt(t *testing.T) {
+	message := Message{Text: "Nook sells for 512 bells", Embed: &MessageEmbed{Title: "Nook"}}
+
+	plain := NotifierCapabilities{MaxLength: 10}.Adapt(message)
+	if plain.Embed != nil || plain.Text != "Nook sell…" {
+		t.Errorf("Expected a short plain message but received %+v", plain)
+	}
+
+	rich := NotifierCapabilities{Embeds: true}.Adapt(message)
+	if rich.Embed == nil || rich.Text != message.Text {
+		t.Errorf("Expected the message to be unchanged but received %+v", rich)
+	}
+}
+
+func TestNotifyUser(t *testing.T) {
+	tf := New()
+	discord := newMockNotifier(NotifierCapabilities{Embeds: true}, nil)
+	email := newMockNotifier(NotifierCapabilities{}, nil)
+	broken := newMockNotifier(NotifierCapabilities{}, errors.New("unreachable"))
+	tf.AddNotifier(NotifierDiscord, discord)
+	tf.AddNotifier(NotifierEmail, email)
+	tf.AddNotifier(NotifierWebhook, broken)
+	tf.DefaultNotifier = NotifierDiscord
+
+	message := Message{Text: "Nook", Embed: &MessageEmbed{Title: "Nook"}}
+
+	err := tf.NotifyUser(User{ID: "default"}, message)
+	if err != nil {
+		t.Errorf("Expected error to be nil but received %v", err)
+	}
+	if len(discord.sent["default"]) != 1 {
+		t.Errorf("Expected users without targets to be sent messages with the default notifier")
+	}
+
+	fanOut := User{ID: "fan-out", NotifyVia: []NotifyTarget{
+		{Notifier: NotifierEmail, Recipient: "me@example.com"},
+		{Notifier: NotifierWebhook, Recipient: "https://example.com/hook"},
+		{Notifier: "missing", Recipient: "nowhere"},
+	}}
+	err = tf.SendUserMessage(fanOut, message)
+	if err != nil {
+		t.Errorf("Expected one working target to be enough but received %v", err)
+	}
+	if len(email.sent["me@example.com"]) != 1 || email.sent["me@example.com"][0].Embed != nil {
+		t.Errorf("Expected an email without an embed but received %+v", email.sent)
+	}
+	if len(discord.sent["fan-out"]) != 0 {
+		t.Errorf("Expected users with targets not to be sent messages with the default notifier")
+	}
+
+	failing := User{ID: "failing", NotifyVia: []NotifyTarget{{Notifier: NotifierWebhook, Recipient: "https://example.com/hook"}}}
+	err = tf.NotifyUser(failing, message)
+	var notifyErr *ErrorNotifyFailed
+	if !errors.As(err, &notifyErr) || len(notifyErr.Errors) != 1 {
+		t.Errorf("Expected ErrorNotifyFailed but received %v", err)
+	}
+}
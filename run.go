@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+)
+
+// Run polls sources straight away and then every PollInterval until ctx is
+// done. A poll in progress is allowed to finish, so islands it found are still
+// sent, and then Run closes notifiers and stores with Close.
+func (tf *TurnipFinder) Run(ctx context.Context) error {
+	if tf.Config.PollInterval <= 0 {
+		return fmt.Errorf("Poll interval must be positive")
+	}
+
+	ticker := tf.Clock.NewTicker(tf.Config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		tf.Poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return tf.Close()
+		case <-ticker.C():
+		}
+	}
+}
+
+// Poll fetches islands from sources and sends them to users and channels.
+// Sources are skipped when no user is polling and no channel is subscribed.
+// ctx only bounds the sources; notifications have their own NotifyTimeout so
+// they are not cut off when ctx is cancelled during shutdown.
+func (tf *TurnipFinder) Poll(ctx context.Context) {
+	pollingUsers, err := tf.PollingUsers()
+	if err != nil {
+		log.Println("Error listing polling users")
+		log.Println(err)
+	}
+	channels, err := tf.SubscribedChannels()
+	if err != nil {
+		log.Println("Error listing subscribed channels")
+		log.Println(err)
+	}
+
+	if len(pollingUsers) == 0 && len(channels) == 0 {
+		return
+	}
+
+	events := tf.PollSources(ctx)
+	for _, event := range events {
+		island := event.Island
+		debugLog.Printf("%s [%d/%d] %s \tPrice: %d\tURL: %s\n", event.Type, island.InQueue, island.MaxQueue, island.Name, island.TurnipPrice, island.URL)
+	}
+
+	err = tf.Dispatch(events)
+	if err != nil {
+		log.Println("Error dispatching islands")
+		log.Println(err)
+	}
+}
+
+// Close closes the notifiers and stores that implement io.Closer, such as
+// transport sessions and the FileStore. Every one is closed even if some
+// fail; the first error is returned.
+func (tf *TurnipFinder) Close() error {
+	closers := make([]io.Closer, 0)
+	for _, name := range tf.NotifierNames() {
+		notifier, err := tf.Notifier(name)
+		if err != nil {
+			continue
+		}
+		if closer, ok := notifier.(io.Closer); ok {
+			closers = append(closers, closer)
+		}
+	}
+
+	// One store usually provides all three.
+	for _, store := range []interface{}{tf.Users, tf.History, tf.Channels} {
+		closer, ok := store.(io.Closer)
+		if ok && !containsCloser(closers, closer) {
+			closers = append(closers, closer)
+		}
+	}
+
+	var first error
+	for _, closer := range closers {
+		err := closer.Close()
+		if err != nil {
+			log.Printf("Error closing %T: %v\n", closer, err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+
+	return first
+}
+
+func containsCloser(closers []io.Closer, closer io.Closer) bool {
+	for _, c := range closers {
+		if c == closer {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock only moves when told to. Its ticker fires on Tick rather than
+// after the interval.
+type testClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	ticks chan time.Time
+}
+
+func newTestClock(now time.Time) *testClock {
+	return &testClock{now: now, ticks: make(chan time.Time)}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func (c *testClock) NewTicker(d time.Duration) Ticker {
+	return testTicker{ticks: c.ticks}
+}
+
+// Tick fires the ticker and returns once Run has received it, which is after
+// the previous poll finished.
+func (c *testClock) Tick() {
+	c.ticks <- c.Now()
+}
+
+type testTicker struct {
+	ticks chan time.Time
+}
+
+func (t testTicker) C() <-chan time.Time {
+	return t.ticks
+}
+
+func (t testTicker) Stop() {}
+
+// pollSource reports each time it is run.
+type pollSource struct {
+	mu      sync.Mutex
+	islands []Island
+	polled  chan struct{}
+}
+
+func (s *pollSource) Name() string {
+	return "Poll"
+}
+
+func (s *pollSource) Run(ctx context.Context) ([]Island, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.polled <- struct{}{}
+	return s.islands, nil
+}
+
+func (s *pollSource) SetIslands(islands []Island) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.islands = islands
+}
+
+type closingNotifier struct {
+	*mockNotifier
+	closed bool
+}
+
+func (n *closingNotifier) Close() error {
+	n.closed = true
+	return nil
+}
+
+// blockingNotifier holds each message until it is released.
+type blockingNotifier struct {
+	started chan struct{}
+	release chan struct{}
+	errs    chan error
+}
+
+func (n *blockingNotifier) Send(ctx context.Context, recipient string, message Message) error {
+	n.started <- struct{}{}
+	<-n.release
+	n.errs <- ctx.Err()
+	return nil
+}
+
+func (n *blockingNotifier) Capabilities() NotifierCapabilities {
+	return NotifierCapabilities{}
+}
+
+func startRun(tf *TurnipFinder) (context.CancelFunc, chan error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- tf.Run(ctx)
+	}()
+
+	return cancel, done
+}
+
+func waitRun(t *testing.T, done chan error) {
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected Run to return nil but received %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after being cancelled")
+	}
+}
+
+func TestRun(t *testing.T) {
+	clock := newTestClock(time.Date(2020, 4, 18, 12, 0, 0, 0, time.UTC))
+	tf := New()
+	tf.Clock = clock
+
+	store, err := NewFileStore(tempStorePath(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tf.Users = store
+	tf.History = store
+	tf.Channels = store
+
+	notifier := &closingNotifier{mockNotifier: newMockNotifier(NotifierCapabilities{}, nil)}
+	tf.AddNotifier(NotifierDiscord, notifier)
+	tf.SetUser(User{ID: "discord:1", Polling: true, SellPrice: 100, MaxInQueue: -1, NotifyOn: IslandAdded})
+
+	source := &pollSource{islands: testIslands(2), polled: make(chan struct{}, 10)}
+	tf.AddSource(source)
+
+	cancel, done := startRun(tf)
+	<-source.polled
+
+	source.SetIslands(testIslands(3))
+	clock.Tick()
+	<-source.polled
+	// Waits for the second poll to finish.
+	clock.Tick()
+	<-source.polled
+
+	cancel()
+	waitRun(t, done)
+
+	if len(notifier.sent["1"]) != 3 {
+		t.Errorf("Expected 3 islands to be sent but received %d", len(notifier.sent["1"]))
+	}
+	if !notifier.closed {
+		t.Error("Expected the notifier to be closed")
+	}
+
+	reopened, err := NewFileStore(store.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := reopened.History("discord:1")
+	if err != nil || len(history) != 3 {
+		t.Errorf("Expected 3 history entries to be saved but received %d, %v", len(history), err)
+	}
+}
+
+func TestRunDrainsNotifications(t *testing.T) {
+	tf := New()
+	tf.Clock = newTestClock(time.Date(2020, 4, 18, 12, 0, 0, 0, time.UTC))
+
+	notifier := &blockingNotifier{
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+		errs:    make(chan error, 1),
+	}
+	tf.AddNotifier(NotifierDiscord, notifier)
+	tf.SetUser(User{ID: "discord:1", Polling: true, SellPrice: 100, MaxInQueue: -1, NotifyOn: IslandAdded})
+	tf.AddSource(&staticSource{islands: testIslands(1)})
+
+	cancel, done := startRun(tf)
+	<-notifier.started
+	cancel()
+
+	select {
+	case <-done:
+		t.Fatal("Expected Run to wait for the notification being sent")
+	default:
+	}
+
+	close(notifier.release)
+	waitRun(t, done)
+
+	if err := <-notifier.errs; err != nil {
+		t.Errorf("Expected the notification not to be cancelled but received %v", err)
+	}
+}
+
+func TestPollChannelsOnly(t *testing.T) {
+	tf := New()
+	sent := 0
+	tf.SendChannelMessage = func(channel Channel, msg Message) error {
+		sent++
+		return nil
+	}
+	channel := NewChannel("channel", "guild")
+	channel.SellPrice = 100
+	tf.SetChannel(channel)
+	tf.AddSource(&staticSource{islands: testIslands(2)})
+
+	tf.Poll(context.Background())
+
+	if sent != 2 {
+		t.Errorf("Expected 2 islands to be posted to the channel with no users polling but received %d", sent)
+	}
+}
+
+func TestRunInvalidInterval(t *testing.T) {
+	tf := New()
+	tf.Config.PollInterval = 0
+
+	err := tf.Run(context.Background())
+	if err == nil {
+		t.Error("Expected an error for a zero poll interval")
+	}
+}
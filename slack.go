@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	NotifierSlack = "slack"
+
+	defaultSlackBaseURL  = "https://slack.com/api"
+	slackMaxBody         = 1 << 20
+	slackMaxText         = 40000
+	slackMaxFields       = 10
+	slackMaxRequestDrift = 5 * time.Minute
+	slackShutdownTimeout = 10 * time.Second
+	// slackAppCommand is a slash command that runs the command named in its
+	// text, for workspaces that register a single command.
+	slackAppCommand = "turnip"
+)
+
+// SlackApp receives slash commands and direct messages over HTTP and posts
+// notifications with chat.postMessage. Incoming requests must be signed with
+// SigningSecret. BaseURL can point at a stand-in for the Web API.
+type SlackApp struct {
+	BaseURL       string
+	Token         string
+	SigningSecret string
+	Client        *http.Client
+	now           func() time.Time
+	mu            sync.Mutex
+	server        *http.Server
+	closed        bool
+	// handling counts commands still running after their event was answered.
+	handling sync.WaitGroup
+}
+
+type ErrorSlackAPI struct {
+	Method string
+	Err    string
+}
+
+func (e *ErrorSlackAPI) Error() string {
+	return fmt.Sprintf("Slack %s failed: %s", e.Method, e.Err)
+}
+
+type ErrorSlackSignature struct{}
+
+func (e *ErrorSlackSignature) Error() string {
+	return "Slack request signature is invalid"
+}
+
+func NewSlackApp(token string, signingSecret string) *SlackApp {
+	return &SlackApp{
+		BaseURL:       defaultSlackBaseURL,
+		Token:         token,
+		SigningSecret: signingSecret,
+		Client:        http.DefaultClient,
+		now:           time.Now,
+	}
+}
+
+func (a *SlackApp) Capabilities() NotifierCapabilities {
+	return NotifierCapabilities{Embeds: true, MaxLength: slackMaxText}
+}
+
+// Send posts a message to a channel or, given a user ID, to the app's direct
+// messages with the user. Embeds are sent as Block Kit blocks with the text as
+// the notification fallback.
+func (a *SlackApp) Send(ctx context.Context, recipient string, message Message) error {
+	params := map[string]interface{}{
+		"channel": recipient,
+		"text":    message.Text,
+	}
+	if message.Embed != nil {
+		params["blocks"] = SlackBlocks(*message.Embed)
+	}
+
+	return a.call(ctx, "chat.postMessage", params)
+}
+
+// SlackBlocks renders an embed as Block Kit blocks.
+func SlackBlocks(embed MessageEmbed) []map[string]interface{} {
+	title := slackEscape(embed.Title)
+	if embed.URL != "" {
+		title = fmt.Sprintf("<%s|%s>", embed.URL, title)
+	}
+	heading := "*" + title + "*"
+	if embed.Description != "" {
+		heading += "\n" + slackEscape(embed.Description)
+	}
+
+	blocks := []map[string]interface{}{
+		{"type": "section", "text": slackMarkdown(heading)},
+	}
+
+	if len(embed.Fields) > 0 {
+		fields := make([]map[string]interface{}, 0, len(embed.Fields))
+		for idx, field := range embed.Fields {
+			if idx == slackMaxFields {
+				break
+			}
+			// Field values use Discord style **bold**.
+			value := strings.ReplaceAll(slackEscape(field.Value), "**", "*")
+			fields = append(fields, slackMarkdown(fmt.Sprintf("*%s*\n%s", slackEscape(field.Name), value)))
+		}
+		blocks = append(blocks, map[string]interface{}{"type": "section", "fields": fields})
+	}
+
+	if embed.Footer != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type":     "context",
+			"elements": []map[string]interface{}{slackMarkdown(slackEscape(embed.Footer))},
+		})
+	}
+
+	if embed.Link != "" {
+		blocks = append(blocks, map[string]interface{}{
+			"type": "actions",
+			"elements": []map[string]interface{}{{
+				"type": "button",
+				"text": map[string]interface{}{"type": "plain_text", "text": "Open island"},
+				"url":  embed.Link,
+			}},
+		})
+	}
+
+	return blocks
+}
+
+func slackMarkdown(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "mrkdwn", "text": text}
+}
+
+// slackEscape escapes the characters Slack uses for links and mentions.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// Handler serves slash commands, sent as forms, and Events API callbacks,
+// sent as JSON, from a single request URL.
+func (a *SlackApp) Handler(tf *TurnipFinder) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, slackMaxBody))
+		if err != nil {
+			http.Error(w, "Could not read request", http.StatusBadRequest)
+			return
+		}
+
+		err = a.Verify(r.Header, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			a.handleEvent(w, r, tf, body)
+			return
+		}
+
+		a.handleSlashCommand(w, tf, body)
+	})
+}
+
+// ListenAndServe serves Handler on addr until Close is called.
+func (a *SlackApp) ListenAndServe(addr string, tf *TurnipFinder) error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	server := &http.Server{Addr: addr, Handler: a.Handler(tf)}
+	a.server = server
+	a.mu.Unlock()
+
+	err := server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+
+	return err
+}
+
+// Close stops the server and waits for requests and commands that are still
+// running, for up to slackShutdownTimeout.
+func (a *SlackApp) Close() error {
+	a.mu.Lock()
+	a.closed = true
+	server := a.server
+	a.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), slackShutdownTimeout)
+	defer cancel()
+
+	if server != nil {
+		err := server.Shutdown(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		a.handling.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Verify checks the request's v0 signature and that it was sent recently, so
+// captured requests cannot be replayed.
+func (a *SlackApp) Verify(header http.Header, body []byte) error {
+	if a.SigningSecret == "" {
+		return &ErrorSlackSignature{}
+	}
+
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return &ErrorSlackSignature{}
+	}
+
+	drift := a.now().Sub(time.Unix(seconds, 0))
+	if drift > slackMaxRequestDrift || drift < -slackMaxRequestDrift {
+		return &ErrorSlackSignature{}
+	}
+
+	expected := SlackSignature(a.SigningSecret, timestamp, body)
+	if !hmac.Equal([]byte(header.Get("X-Slack-Signature")), []byte(expected)) {
+		return &ErrorSlackSignature{}
+	}
+
+	return nil
+}
+
+// SlackSignature signs a request body the way Slack does.
+func SlackSignature(signingSecret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// handleSlashCommand runs /sell 500, or /turnip sell 500. Slack wants an
+// answer within three seconds, so the request is acknowledged straight away
+// and the replies are posted to the command's response_url in one ephemeral
+// message once the command has finished.
+func (a *SlackApp) handleSlashCommand(w http.ResponseWriter, tf *TurnipFinder, body []byte) {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		http.Error(w, "Could not parse command", http.StatusBadRequest)
+		return
+	}
+
+	responseURL := form.Get("response_url")
+	if responseURL == "" {
+		http.Error(w, "Missing response_url", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimPrefix(form.Get("command"), "/")
+	args := form.Get("text")
+	if name == slackAppCommand {
+		name, args = cutWord(args)
+		if name == "" {
+			name = "help"
+		}
+	}
+
+	a.handling.Add(1)
+	go func() {
+		defer a.handling.Done()
+
+		user, err := tf.TransportUser(NotifierSlack, form.Get("user_id"), form.Get("user_name"))
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		replies := make([]string, 0, 1)
+		err = tf.RunCommand(ChatCommandInput{
+			Name:      name,
+			Args:      args,
+			User:      user,
+			ChannelID: form.Get("channel_id"),
+			Reply: func(msg string) error {
+				replies = append(replies, msg)
+				return nil
+			},
+		})
+		if err != nil {
+			log.Println(err)
+		}
+		if len(replies) == 0 {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), tf.Config.NotifyTimeout)
+		defer cancel()
+
+		err = a.respond(ctx, responseURL, truncateText(strings.Join(replies, "\n"), slackMaxText))
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+}
+
+// respond posts an ephemeral reply to a slash command's response_url.
+func (a *SlackApp) respond(ctx context.Context, responseURL string, text string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          text,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responseURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &ErrorSlackAPI{Method: "response_url", Err: resp.Status}
+	}
+
+	return nil
+}
+
+type slackEventCallback struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Event     struct {
+		Type        string `json:"type"`
+		Subtype     string `json:"subtype"`
+		BotID       string `json:"bot_id"`
+		User        string `json:"user"`
+		Text        string `json:"text"`
+		Channel     string `json:"channel"`
+		ChannelType string `json:"channel_type"`
+	} `json:"event"`
+}
+
+// handleEvent answers the URL verification challenge and runs commands sent
+// to the app as direct messages, with or without a leading !. Slack wants an
+// answer within three seconds, so commands run after the response and reply
+// with chat.postMessage.
+func (a *SlackApp) handleEvent(w http.ResponseWriter, r *http.Request, tf *TurnipFinder, body []byte) {
+	var callback slackEventCallback
+	err := json.Unmarshal(body, &callback)
+	if err != nil {
+		http.Error(w, "Could not parse event", http.StatusBadRequest)
+		return
+	}
+
+	if callback.Type == "url_verification" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(callback.Challenge))
+		return
+	}
+
+	// Slack resends events it thinks timed out; the first delivery already
+	// ran the command.
+	if r.Header.Get("X-Slack-Retry-Num") != "" {
+		return
+	}
+
+	event := callback.Event
+	if callback.Type != "event_callback" || event.Type != "message" || event.ChannelType != "im" || event.Subtype != "" || event.BotID != "" {
+		return
+	}
+
+	name, args := cutWord(strings.TrimPrefix(strings.TrimSpace(event.Text), "!"))
+	if name == "" {
+		return
+	}
+
+	a.handling.Add(1)
+	go func() {
+		defer a.handling.Done()
+
+		user, err := tf.TransportUser(NotifierSlack, event.User, "")
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		err = tf.RunCommand(ChatCommandInput{
+			Name:      name,
+			Args:      args,
+			User:      user,
+			ChannelID: event.Channel,
+			Reply: func(msg string) error {
+				ctx, cancel := context.WithTimeout(context.Background(), tf.Config.NotifyTimeout)
+				defer cancel()
+
+				return a.Send(ctx, event.Channel, a.Capabilities().Adapt(TextMessage(msg)))
+			},
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+}
+
+func (a *SlackApp) call(ctx context.Context, method string, params interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/%s", a.BaseURL, method), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var data struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	if err != nil {
+		return fmt.Errorf("Slack %s returned status %d: %w", method, resp.StatusCode, err)
+	}
+	if !data.OK {
+		return &ErrorSlackAPI{Method: method, Err: data.Error}
+	}
+
+	return nil
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockSlackAPI records chat.postMessage calls and slash command responses
+// posted to /response.
+type mockSlackAPI struct {
+	mu        sync.Mutex
+	posted    []map[string]interface{}
+	responses []map[string]interface{}
+	auth      []string
+	replied   chan struct{}
+}
+
+func (api *mockSlackAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	if r.URL.Path == "/response" {
+		var params map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&params)
+		api.responses = append(api.responses, params)
+		api.replied <- struct{}{}
+		return
+	}
+
+	if r.URL.Path != "/chat.postMessage" {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "unknown_method"})
+		return
+	}
+
+	var params map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&params)
+	if params["channel"] == "archived" {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error": "is_archived"})
+		return
+	}
+
+	api.posted = append(api.posted, params)
+	api.auth = append(api.auth, r.Header.Get("Authorization"))
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+	api.replied <- struct{}{}
+}
+
+var slackTestNow = time.Date(2020, 4, 5, 12, 0, 0, 0, time.UTC)
+
+func newTestSlackApp(baseURL string) *SlackApp {
+	app := NewSlackApp("xoxb-token", "secret")
+	app.BaseURL = baseURL
+	app.now = func() time.Time { return slackTestNow }
+
+	return app
+}
+
+func signedSlackRequest(body string, contentType string, timestamp time.Time, secret string) *http.Request {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/slack", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Slack-Request-Timestamp", ts)
+	req.Header.Set("X-Slack-Signature", SlackSignature(secret, ts, []byte(body)))
+
+	return req
+}
+
+func TestSlackVerify(t *testing.T) {
+	testTable := []struct {
+		Name      string
+		Secret    string
+		Timestamp time.Time
+		Tamper    bool
+		Valid     bool
+	}{
+		{Name: "Accepts signed requests", Secret: "secret", Timestamp: slackTestNow, Valid: true},
+		{Name: "Rejects the wrong secret", Secret: "guess", Timestamp: slackTestNow},
+		{Name: "Rejects changed bodies", Secret: "secret", Timestamp: slackTestNow, Tamper: true},
+		{Name: "Rejects old requests", Secret: "secret", Timestamp: slackTestNow.Add(-10 * time.Minute)},
+	}
+
+	app := newTestSlackApp("")
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			req := signedSlackRequest("command=%2Fsell&text=500", "application/x-www-form-urlencoded", tcase.Timestamp, tcase.Secret)
+			body := []byte("command=%2Fsell&text=500")
+			if tcase.Tamper {
+				body = []byte("command=%2Fsell&text=600")
+			}
+
+			err := app.Verify(req.Header, body)
+			if (err == nil) != tcase.Valid {
+				t.Errorf("Expected valid to be %t but received %v", tcase.Valid, err)
+			}
+		})
+	}
+
+	app.SigningSecret = ""
+	req := signedSlackRequest("x", "text/plain", slackTestNow, "")
+	if app.Verify(req.Header, []byte("x")) == nil {
+		t.Error("Expected requests to be rejected without a signing secret")
+	}
+}
+
+func TestSlackSlashCommand(t *testing.T) {
+	testTable := []struct {
+		Name         string
+		Form         url.Values
+		ExpectedText string
+	}{
+		{
+			Name:         "Runs a command registered as a slash command",
+			Form:         url.Values{"command": {"/sell"}, "text": {"500"}, "user_id": {"U1"}, "user_name": {"daisy"}},
+			ExpectedText: "500",
+		}, {
+			Name:         "Runs the command named in the app command",
+			Form:         url.Values{"command": {"/turnip"}, "text": {"status"}, "user_id": {"U1"}},
+			ExpectedText: "You are",
+		}, {
+			Name:         "Shows help for the app command without text",
+			Form:         url.Values{"command": {"/turnip"}, "user_id": {"U1"}},
+			ExpectedText: "Commands:",
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			api := &mockSlackAPI{replied: make(chan struct{}, 10)}
+			server := httptest.NewServer(api)
+			defer server.Close()
+
+			tf := New()
+			tf.RegisterDefaultCommands()
+			app := newTestSlackApp(server.URL)
+
+			tcase.Form.Set("response_url", server.URL+"/response")
+			rec := httptest.NewRecorder()
+			app.Handler(tf).ServeHTTP(rec, signedSlackRequest(tcase.Form.Encode(), "application/x-www-form-urlencoded", slackTestNow, "secret"))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status %d but received %d", http.StatusOK, rec.Code)
+			}
+
+			select {
+			case <-api.replied:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Expected a response to be posted")
+			}
+
+			api.mu.Lock()
+			defer api.mu.Unlock()
+			resp := api.responses[0]
+			if resp["response_type"] != "ephemeral" || !strings.Contains(resp["text"].(string), tcase.ExpectedText) {
+				t.Errorf("Expected an ephemeral reply containing %q but received %v", tcase.ExpectedText, resp)
+			}
+
+			if _, err := tf.User("slack:U1"); err != nil {
+				t.Errorf("Expected the Slack user to be added but received %v", err)
+			}
+		})
+	}
+
+	tf := New()
+	rec := httptest.NewRecorder()
+	newTestSlackApp("").Handler(tf).ServeHTTP(rec, signedSlackRequest("command=%2Fsell", "application/x-www-form-urlencoded", slackTestNow, "wrong"))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected unsigned requests to be refused but received %d", rec.Code)
+	}
+}
+
+func TestSlackSlashCommandAnswersFirst(t *testing.T) {
+	api := &mockSlackAPI{replied: make(chan struct{}, 10)}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	tf := New()
+	release := make(chan struct{})
+	tf.AddCommand("slow", func(tf *TurnipFinder, input ChatCommandInput) error {
+		<-release
+		return input.Reply("done")
+	})
+	app := newTestSlackApp(server.URL)
+
+	form := url.Values{"command": {"/slow"}, "user_id": {"U1"}, "response_url": {server.URL + "/response"}}
+	rec := httptest.NewRecorder()
+	app.Handler(tf).ServeHTTP(rec, signedSlackRequest(form.Encode(), "application/x-www-form-urlencoded", slackTestNow, "secret"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the command to be acknowledged before it finished but received %d", rec.Code)
+	}
+
+	close(release)
+	select {
+	case <-api.replied:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a response to be posted")
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if api.responses[0]["text"] != "done" {
+		t.Errorf("Expected the reply to be posted to response_url but received %v", api.responses)
+	}
+	if err := app.Close(); err != nil {
+		t.Errorf("Expected Close to return nil but received %v", err)
+	}
+}
+
+func TestSlackEvents(t *testing.T) {
+	api := &mockSlackAPI{replied: make(chan struct{}, 10)}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	tf := New()
+	tf.RegisterDefaultCommands()
+	app := newTestSlackApp(server.URL)
+	handler := app.Handler(tf)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedSlackRequest(`{"type": "url_verification", "challenge": "abc"}`, "application/json", slackTestNow, "secret"))
+	if rec.Code != http.StatusOK || rec.Body.String() != "abc" {
+		t.Errorf("Expected the challenge to be answered but received %d %q", rec.Code, rec.Body.String())
+	}
+
+	for _, event := range []string{
+		`{"type": "event_callback", "event": {"type": "message", "subtype": "bot_message", "bot_id": "B1", "text": "!sell 1", "channel": "D1", "channel_type": "im"}}`,
+		`{"type": "event_callback", "event": {"type": "message", "user": "U2", "text": "sell 1", "channel": "C1", "channel_type": "channel"}}`,
+		`{"type": "event_callback", "event": {"type": "message", "user": "U2", "text": "!sell 450", "channel": "D1", "channel_type": "im"}}`,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, signedSlackRequest(event, "application/json", slackTestNow, "secret"))
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected events to be acknowledged but received %d", rec.Code)
+		}
+	}
+
+	select {
+	case <-api.replied:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a reply to be posted")
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if len(api.posted) != 1 || api.posted[0]["channel"] != "D1" || !strings.Contains(api.posted[0]["text"].(string), "450") {
+		t.Errorf("Unexpected posts %v", api.posted)
+	}
+	if api.auth[0] != "Bearer xoxb-token" {
+		t.Errorf("Expected the bot token to be sent but received %q", api.auth[0])
+	}
+
+	user, _ := tf.User("slack:U2")
+	if user.SellPrice != 450 {
+		t.Errorf("Expected the command to run once for the direct message but sell price is %d", user.SellPrice)
+	}
+}
+
+func TestSlackSend(t *testing.T) {
+	api := &mockSlackAPI{replied: make(chan struct{}, 10)}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	tf := New()
+	app := newTestSlackApp(server.URL)
+	tf.AddNotifier(NotifierSlack, app)
+
+	island := Island{Name: "A<B>&C", TurnipPrice: 512, InQueue: 4, MaxQueue: 20, URL: "https://example.com/island/1", Source: "Turnip Exchange"}
+	err := tf.SendUserMessage(User{ID: "slack:U1"}, tf.RenderIslandMessage(island, FormatFull, ""))
+	if err != nil {
+		t.Fatalf("Expected error to be nil but received %v", err)
+	}
+
+	if len(api.posted) != 1 || api.posted[0]["channel"] != "U1" {
+		t.Fatalf("Unexpected posts %v", api.posted)
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(api.posted[0]["blocks"])
+	blocks := buf.String()
+	for _, expected := range []string{
+		`"text":"*<https://example.com/island/1|A&lt;B&gt;&amp;C>*"`,
+		`"text":"*Buying turnips for*\n*512* bells"`,
+		`"type":"context"`,
+		`"url":"https://example.com/island/1"`,
+	} {
+		if !strings.Contains(blocks, expected) {
+			t.Errorf("Expected blocks to contain %s but received %s", expected, blocks)
+		}
+	}
+
+	err = app.Send(context.Background(), "archived", TextMessage("hello"))
+	var apiErr *ErrorSlackAPI
+	if !errors.As(err, &apiErr) || apiErr.Err != "is_archived" {
+		t.Errorf("Expected ErrorSlackAPI but received %v", err)
+	}
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+const SourceTurnipExchange = "turnipexchange"
+
+// sourceFactories create the sources that can be enabled by name in the
+// configuration.
+var sourceFactories = map[string]func() IslandSource{
+	SourceTurnipExchange: func() IslandSource { return NewTurnipExchangeSource() },
+}
+
+// SourceNames returns the names of the sources that can be enabled, sorted.
+func SourceNames() []string {
+	names := make([]string, 0, len(sourceFactories))
+	for name := range sourceFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// NewSource creates a source by name.
+func NewSource(name string) (IslandSource, error) {
+	factory, ok := sourceFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown source %q", name)
+	}
+
+	return factory(), nil
+}
+
+// IslandSource returns the islands currently listed by a site. Run should
+// stop when ctx is done and classify failures with ErrorSourceTransient,
+// ErrorSourceRateLimited or ErrorSourceFatal. Any other error is treated as
+// transient.
+type IslandSource interface {
+	Name() string
+	Run(ctx context.Context) ([]Island, error)
+}
+
+// IslandCoverage reports whether an island is part of what a source fetched
+// in a run.
+type IslandCoverage func(island Island) bool
+
+// PartialIslandSource is implemented by sources that may only fetch some of
+// their listings in a run, for example to stay within a rate limit. Islands
+// outside the returned coverage are not closed for being missing.
+type PartialIslandSource interface {
+	IslandSource
+	RunPartial(ctx context.Context) ([]Island, IslandCoverage, error)
+}
+
+// LegacyIslandSource is the original source interface, which cannot report
+// failures. Wrap it with AdaptLegacySource to register it.
+type LegacyIslandSource interface {
+	Name() string
+	Run() []Island
+}
+
+type legacySourceAdapter struct {
+	source LegacyIslandSource
+}
+
+func AdaptLegacySource(source LegacyIslandSource) IslandSource {
+	return &legacySourceAdapter{source: source}
+}
+
+func (a *legacySourceAdapter) Name() string {
+	return a.source.Name()
+}
+
+func (a *legacySourceAdapter) Run(ctx context.Context) ([]Island, error) {
+	return a.source.Run(), nil
+}
+
+// SourceQuery describes what polling users and channels are looking for so
+// a source can ask its site for the right listings. Sources should treat a
+// missing query as a request for everything they normally return.
+type SourceQuery struct {
+	// AnyFee is set when a user accepts islands that charge an entry fee.
+	AnyFee bool
+	// NoFee is set when a user only wants islands without an entry fee.
+	NoFee bool
+	// Listings are the kinds of listing users are watching.
+	Listings []Listing
+}
+
+func (q SourceQuery) WantsListing(listing Listing) bool {
+	for _, wanted := range q.Listings {
+		if wanted == listing {
+			return true
+		}
+	}
+
+	return false
+}
+
+type sourceQueryKey struct{}
+
+func WithSourceQuery(ctx context.Context, query SourceQuery) context.Context {
+	return context.WithValue(ctx, sourceQueryKey{}, query)
+}
+
+func SourceQueryFromContext(ctx context.Context) (SourceQuery, bool) {
+	query, ok := ctx.Value(sourceQueryKey{}).(SourceQuery)
+	return query, ok
+}
+
+// pollingSubscribers returns the polling users and the settings of the
+// subscribed channels, which together decide what sources fetch.
+func (tf *TurnipFinder) pollingSubscribers() ([]User, error) {
+	users, err := tf.PollingUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	channels, err := tf.SubscribedChannels()
+	if err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		users = append(users, channel.settings())
+	}
+
+	return users, nil
+}
+
+func NewSourceQuery(users []User) SourceQuery {
+	query := SourceQuery{}
+	for _, user := range users {
+		listings := make([]Listing, 0)
+		if user.HasDefaultWatch() || len(user.ActiveWatches()) == 0 {
+			if user.MaxFee == 0 {
+				query.NoFee = true
+			} else {
+				query.AnyFee = true
+			}
+
+			listings = append(listings, UserListings(user)...)
+		}
+
+		for _, watch := range user.ActiveWatches() {
+			query.AnyFee = true
+			if ExpressionChoosesListing(watch.Expr) {
+				listings = append(listings, ListingSell, ListingBuy)
+			} else {
+				listings = append(listings, watch.Listing)
+			}
+		}
+
+		for _, listing := range listings {
+			if !query.WantsListing(listing) {
+				query.Listings = append(query.Listings, listing)
+			}
+		}
+	}
+
+	return query
+}
+
+// SourceStats counts what happened to a source's runs. Runs that ended
+// rate limited, including runs the source skipped to stay within its own
+// limit, are counted in RateLimited rather than Runs or Failures.
+type SourceStats struct {
+	Name         string
+	Runs         int
+	Failures     int
+	Retries      int
+	Skipped      int
+	RateLimited  int
+	LastDuration time.Duration
+	LastError    error
+	BackoffUntil time.Time
+	Disabled     bool
+}
+
+// Status summarises the stats in one line, as of now.
+func (s SourceStats) Status(now time.Time) string {
+	status := fmt.Sprintf("%s: %d runs, %d failures, %d retries, %d skipped, %d rate limited", s.Name, s.Runs, s.Failures, s.Retries, s.Skipped, s.RateLimited)
+	if s.Runs > 0 {
+		status += fmt.Sprintf(", last took %s", s.LastDuration.Round(time.Millisecond))
+	}
+	if s.LastError != nil {
+		status += fmt.Sprintf(", last error: %v", s.LastError)
+	}
+
+	if s.Disabled {
+		status += ", disabled"
+	} else if s.BackoffUntil.After(now) {
+		status += fmt.Sprintf(", waiting until %s", s.BackoffUntil.Format("15:04:05"))
+	}
+
+	return status
+}
+
+// ErrorSourceTransient is a failure that may succeed if retried, such as a
+// network error.
+type ErrorSourceTransient struct {
+	Err error
+}
+
+func (e *ErrorSourceTransient) Error() string {
+	return fmt.Sprintf("Transient source error: %v", e.Err)
+}
+
+func (e *ErrorSourceTransient) Unwrap() error {
+	return e.Err
+}
+
+// ErrorSourceRateLimited asks the poller not to run the source again until
+// RetryAfter has passed.
+type ErrorSourceRateLimited struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *ErrorSourceRateLimited) Error() string {
+	return fmt.Sprintf("Source rate limited for %s: %v", e.RetryAfter, e.Err)
+}
+
+func (e *ErrorSourceRateLimited) Unwrap() error {
+	return e.Err
+}
+
+// ErrorSourceFatal disables the source until the bot is restarted.
+type ErrorSourceFatal struct {
+	Err error
+}
+
+func (e *ErrorSourceFatal) Error() string {
+	return fmt.Sprintf("Fatal source error: %v", e.Err)
+}
+
+func (e *ErrorSourceFatal) Unwrap() error {
+	return e.Err
+}
+
+type ErrorSourceBusy struct{}
+
+func (e *ErrorSourceBusy) Error() string {
+	return "Previous run has not finished"
+}
+
+type ErrorSourceWaiting struct {
+	Until    time.Time
+	Disabled bool
+}
+
+func (e *ErrorSourceWaiting) Error() string {
+	if e.Disabled {
+		return "Source is disabled"
+	}
+
+	return fmt.Sprintf("Source is backing off until %s", e.Until.Format(time.RFC3339))
+}
+
+type sourceState struct {
+	source  IslandSource
+	running bool
+	stats   SourceStats
+}
+
+type sourceResult struct {
+	state    *sourceState
+	islands  []Island
+	covered  IslandCoverage
+	duration time.Duration
+	err      error
+}
+
+func (tf *TurnipFinder) AddSource(source IslandSource) {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+
+	tf.sources = append(tf.sources, &sourceState{
+		source: source,
+		stats:  SourceStats{Name: source.Name()},
+	})
+}
+
+func (tf *TurnipFinder) Sources() []IslandSource {
+	tf.mu.RLock()
+	defer tf.mu.RUnlock()
+
+	sources := make([]IslandSource, 0, len(tf.sources))
+	for _, state := range tf.sources {
+		sources = append(sources, state.source)
+	}
+
+	return sources
+}
+
+func (tf *TurnipFinder) SourceStats() []SourceStats {
+	tf.mu.RLock()
+	defer tf.mu.RUnlock()
+
+	stats := make([]SourceStats, 0, len(tf.sources))
+	for _, state := range tf.sources {
+		stats = append(stats, state.stats)
+	}
+
+	return stats
+}
+
+// PollSources runs every source in its own goroutine and returns an event for
+// every island that was added, updated or removed. A source that is still
+// running from a previous cycle, times out or panics is skipped without
+// affecting the others. Transient failures are retried, rate limited sources
+// are left alone until their back off has passed and fatal failures disable
+// the source.
+func (tf *TurnipFinder) PollSources(ctx context.Context) []IslandEvent {
+	if _, ok := SourceQueryFromContext(ctx); !ok {
+		subscribers, err := tf.pollingSubscribers()
+		if err != nil {
+			log.Println(err)
+		} else {
+			ctx = WithSourceQuery(ctx, NewSourceQuery(subscribers))
+		}
+	}
+
+	tf.mu.RLock()
+	states := append([]*sourceState(nil), tf.sources...)
+	tf.mu.RUnlock()
+
+	results := make(chan sourceResult, len(states))
+	for _, state := range states {
+		go func(state *sourceState) {
+			results <- tf.runSource(ctx, state)
+		}(state)
+	}
+
+	events := make([]IslandEvent, 0)
+	for range states {
+		result := <-results
+		tf.recordSourceResult(result)
+
+		name := result.state.source.Name()
+		var rateLimited *ErrorSourceRateLimited
+		switch result.err.(type) {
+		case nil:
+			debugLog.Printf("Source %s returned %d islands in %s\n", name, len(result.islands), result.duration)
+		case *ErrorSourceBusy, *ErrorSourceWaiting:
+			continue
+		default:
+			if errors.As(result.err, &rateLimited) {
+				debugLog.Printf("Source %s is rate limited: %v\n", name, result.err)
+			} else {
+				log.Printf("Source %s failed after %s: %v\n", name, result.duration, result.err)
+			}
+			continue
+		}
+
+		islands := make([]Island, 0, len(result.islands))
+		for _, island := range result.islands {
+			err := ValidateIsland(island)
+			if err != nil {
+				log.Printf("Could not add Island from %s.\tName: %q\tURL: %s\n", name, island.Name, island.URL)
+				log.Println(err)
+				continue
+			}
+
+			islands = append(islands, island)
+		}
+
+		events = append(events, tf.mergeSourceIslands(name, islands, result.covered)...)
+	}
+
+	return events
+}
+
+func (tf *TurnipFinder) runSource(ctx context.Context, state *sourceState) sourceResult {
+	tf.mu.Lock()
+	if state.stats.Disabled || tf.now().Before(state.stats.BackoffUntil) {
+		tf.mu.Unlock()
+		return sourceResult{state: state, err: &ErrorSourceWaiting{Until: state.stats.BackoffUntil, Disabled: state.stats.Disabled}}
+	} else if state.running {
+		tf.mu.Unlock()
+		return sourceResult{state: state, err: &ErrorSourceBusy{}}
+	}
+	state.running = true
+	tf.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, tf.Config.SourceTimeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan sourceResult, 1)
+	go func() {
+		defer func() {
+			tf.mu.Lock()
+			state.running = false
+			tf.mu.Unlock()
+
+			if r := recover(); r != nil {
+				done <- sourceResult{err: fmt.Errorf("source panicked: %v", r)}
+			}
+		}()
+
+		done <- tf.runSourceWithRetries(ctx, state)
+	}()
+
+	var result sourceResult
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		result = sourceResult{err: &ErrorSourceTransient{Err: ctx.Err()}}
+	}
+
+	result.state = state
+	result.duration = time.Since(start)
+	return result
+}
+
+// runSourceWithRetries retries transient failures up to Config.SourceRetries
+// times while ctx allows, waiting Config.SourceRetryDelay before the first
+// retry and twice as long before each one after.
+func (tf *TurnipFinder) runSourceWithRetries(ctx context.Context, state *sourceState) sourceResult {
+	var result sourceResult
+	for attempt := 0; attempt <= tf.Config.SourceRetries; attempt++ {
+		if attempt > 0 {
+			if !sleepContext(ctx, tf.Config.SourceRetryDelay<<uint(attempt-1)) {
+				break
+			}
+
+			tf.mu.Lock()
+			state.stats.Retries++
+			tf.mu.Unlock()
+		}
+
+		if partial, ok := state.source.(PartialIslandSource); ok {
+			result.islands, result.covered, result.err = partial.RunPartial(ctx)
+		} else {
+			result.islands, result.err = state.source.Run(ctx)
+		}
+		if result.err == nil || !isTransientSourceError(result.err) || ctx.Err() != nil {
+			break
+		}
+	}
+
+	return result
+}
+
+// sleepContext waits for d and reports whether it did, or returns false as
+// soon as ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func isTransientSourceError(err error) bool {
+	var rateLimited *ErrorSourceRateLimited
+	var fatal *ErrorSourceFatal
+
+	return !errors.As(err, &rateLimited) && !errors.As(err, &fatal)
+}
+
+func (tf *TurnipFinder) recordSourceResult(result sourceResult) {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+
+	stats := &result.state.stats
+	switch result.err.(type) {
+	case *ErrorSourceBusy, *ErrorSourceWaiting:
+		stats.Skipped++
+		return
+	}
+
+	var rateLimited *ErrorSourceRateLimited
+	if errors.As(result.err, &rateLimited) {
+		stats.RateLimited++
+		retryAfter := rateLimited.RetryAfter
+		if retryAfter <= 0 {
+			retryAfter = tf.Config.SourceBackoff
+		}
+		stats.BackoffUntil = tf.now().Add(retryAfter)
+		return
+	}
+
+	stats.Runs++
+	stats.LastDuration = result.duration
+	stats.LastError = result.err
+	if result.err == nil {
+		return
+	}
+
+	stats.Failures++
+
+	var fatal *ErrorSourceFatal
+	if errors.As(result.err, &fatal) {
+		stats.Disabled = true
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type blockingSource struct {
+	release chan struct{}
+}
+
+func (s *blockingSource) Name() string {
+	return "Blocking"
+}
+
+func (s *blockingSource) Run() []Island {
+	<-s.release
+	return testIslands(1)
+}
+
+// querySource records the query it is run with.
+type querySource struct {
+	query SourceQuery
+}
+
+func (s *querySource) Name() string {
+	return "Query"
+}
+
+func (s *querySource) Run(ctx context.Context) ([]Island, error) {
+	s.query, _ = SourceQueryFromContext(ctx)
+	return nil, nil
+}
+
+type panickingSource struct{}
+
+func (s *panickingSource) Name() string {
+	return "Panicking"
+}
+
+func (s *panickingSource) Run() []Island {
+	panic("boom")
+}
+
+func TestPollSourcesIsolation(t *testing.T) {
+	testTable := []struct {
+		Name             string
+		Sources          []IslandSource
+		ExpectedIslands  int
+		ExpectedFailures []int
+	}{
+		{
+			Name: "Returns islands from every source",
+			Sources: []IslandSource{
+				&staticSource{name: "First", islands: testIslands(2)},
+				&staticSource{name: "Second", islands: testIslands(5)[2:]},
+			},
+			ExpectedIslands:  5,
+			ExpectedFailures: []int{0, 0},
+		}, {
+			Name: "A hung source does not block the others",
+			Sources: []IslandSource{
+				AdaptLegacySource(&blockingSource{release: make(chan struct{})}),
+				&staticSource{islands: testIslands(3)},
+			},
+			ExpectedIslands:  3,
+			ExpectedFailures: []int{1, 0},
+		}, {
+			Name: "A panicking source does not crash the others",
+			Sources: []IslandSource{
+				AdaptLegacySource(&panickingSource{}),
+				&staticSource{islands: testIslands(3)},
+			},
+			ExpectedIslands:  3,
+			ExpectedFailures: []int{1, 0},
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			tf := New()
+			tf.Config.SourceTimeout = 20 * time.Millisecond
+			for _, source := range tcase.Sources {
+				tf.AddSource(source)
+			}
+
+			events := tf.PollSources(context.Background())
+			if len(events) != tcase.ExpectedIslands {
+				t.Errorf("Expected %d islands but received %d", tcase.ExpectedIslands, len(events))
+			}
+
+			for idx, stats := range tf.SourceStats() {
+				if stats.Runs != 1 {
+					t.Errorf("Expected source %s to have run once but found %d", stats.Name, stats.Runs)
+				}
+				if stats.Failures != tcase.ExpectedFailures[idx] {
+					t.Errorf("Expected source %s to have %d failures but found %d", stats.Name, tcase.ExpectedFailures[idx], stats.Failures)
+				}
+			}
+
+			for _, source := range tcase.Sources {
+				if adapter, ok := source.(*legacySourceAdapter); ok {
+					if blocking, ok := adapter.source.(*blockingSource); ok {
+						close(blocking.release)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPollSourcesSkipsBusySource(t *testing.T) {
+	tf := New()
+	tf.Config.SourceTimeout = 20 * time.Millisecond
+	source := &blockingSource{release: make(chan struct{})}
+	tf.AddSource(AdaptLegacySource(source))
+	defer close(source.release)
+
+	tf.PollSources(context.Background())
+	tf.PollSources(context.Background())
+
+	stats := tf.SourceStats()[0]
+	if stats.Runs != 1 {
+		t.Errorf("Expected the source to have run once but found %d", stats.Runs)
+	}
+	if stats.Skipped != 1 {
+		t.Errorf("Expected the source to have been skipped once but found %d", stats.Skipped)
+	}
+}
+
+type failingSource struct {
+	mu    sync.Mutex
+	errs  []error
+	calls int
+}
+
+func (s *failingSource) Name() string {
+	return "Failing"
+}
+
+func (s *failingSource) Run(ctx context.Context) ([]Island, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return nil, err
+	}
+
+	return testIslands(2), nil
+}
+
+func TestPollSourcesErrorHandling(t *testing.T) {
+	testTable := []struct {
+		Name                string
+		Errors              []error
+		ExpectedIslands     []int
+		ExpectedCalls       int
+		ExpectedFailures    int
+		ExpectedRateLimited int
+		ExpectedDisabled    bool
+	}{
+		{
+			Name:            "Retries transient errors within a poll",
+			Errors:          []error{&ErrorSourceTransient{Err: errors.New("timeout")}, errors.New("unclassified")},
+			ExpectedIslands: []int{2, 0},
+			ExpectedCalls:   4,
+		}, {
+			Name: "Gives up after the configured retries",
+			Errors: []error{
+				&ErrorSourceTransient{Err: errors.New("timeout")},
+				&ErrorSourceTransient{Err: errors.New("timeout")},
+				&ErrorSourceTransient{Err: errors.New("timeout")},
+			},
+			ExpectedIslands:  []int{0, 2},
+			ExpectedCalls:    4,
+			ExpectedFailures: 1,
+		}, {
+			Name:                "Backs off after being rate limited",
+			Errors:              []error{&ErrorSourceRateLimited{Err: errors.New("slow down"), RetryAfter: time.Hour}},
+			ExpectedIslands:     []int{0, 0},
+			ExpectedCalls:       1,
+			ExpectedRateLimited: 1,
+		}, {
+			Name:             "Disables the source after a fatal error",
+			Errors:           []error{&ErrorSourceFatal{Err: errors.New("gone")}},
+			ExpectedIslands:  []int{0, 0},
+			ExpectedCalls:    1,
+			ExpectedFailures: 1,
+			ExpectedDisabled: true,
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			tf := New()
+			tf.Config.SourceRetryDelay = time.Millisecond
+			source := &failingSource{errs: tcase.Errors}
+			tf.AddSource(source)
+
+			for idx, expected := range tcase.ExpectedIslands {
+				events := tf.PollSources(context.Background())
+				if len(events) != expected {
+					t.Errorf("Expected poll %d to return %d events but received %d", idx, expected, len(events))
+				}
+			}
+
+			if source.calls != tcase.ExpectedCalls {
+				t.Errorf("Expected the source to be called %d times but found %d", tcase.ExpectedCalls, source.calls)
+			}
+
+			stats := tf.SourceStats()[0]
+			if stats.Failures != tcase.ExpectedFailures || stats.RateLimited != tcase.ExpectedRateLimited {
+				t.Errorf("Expected %d failures and %d rate limited runs but found %d and %d", tcase.ExpectedFailures, tcase.ExpectedRateLimited, stats.Failures, stats.RateLimited)
+			}
+			if stats.Disabled != tcase.ExpectedDisabled {
+				t.Errorf("Expected disabled to be %t but found %t", tcase.ExpectedDisabled, stats.Disabled)
+			}
+		})
+	}
+}
+
+func TestPollSourcesRetryDelayStopsOnCancel(t *testing.T) {
+	tf := New()
+	tf.Config.SourceRetryDelay = time.Hour
+	source := &failingSource{errs: []error{&ErrorSourceTransient{Err: errors.New("timeout")}}}
+	tf.AddSource(source)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	tf.PollSources(ctx)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the retry wait to stop with ctx but it took %s", elapsed)
+	}
+	// The source may still be running when PollSources gives up on it.
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	if source.calls != 1 {
+		t.Errorf("Expected the source not to be retried after ctx was done but it was called %d times", source.calls)
+	}
+}
+
+func TestPollSourcesQueryIncludesChannels(t *testing.T) {
+	tf := New()
+	tf.SendChannelMessage = func(channel Channel, msg Message) error {
+		return nil
+	}
+	channel := NewChannel("channel", "guild")
+	channel.BuyPrice = 100
+	tf.SetChannel(channel)
+	tf.SetUser(User{ID: "user", Polling: true, SellPrice: 500, MaxFee: 0})
+
+	source := &querySource{}
+	tf.AddSource(source)
+	tf.PollSources(context.Background())
+
+	if !source.query.WantsListing(ListingBuy) || !source.query.WantsListing(ListingSell) {
+		t.Errorf("Expected the channel's buy listings to be queried with the user's sell listings but received %+v", source.query)
+	}
+	if !source.query.AnyFee || !source.query.NoFee {
+		t.Errorf("Expected the channel to accept fees and the user to refuse them but received %+v", source.query)
+	}
+}
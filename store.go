@@ -0,0 +1,451 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+type UserStore interface {
+	Get(ID string) (User, error)
+	Put(user User) error
+	List() ([]User, error)
+	Delete(ID string) error
+}
+
+// HistoryStore records which islands were sent to each user. History returns
+// entries oldest first.
+type HistoryStore interface {
+	AddHistory(userID string, entry HistoryEntry) error
+	History(userID string) ([]HistoryEntry, error)
+}
+
+// ChannelStore keeps the channels subscribed to islands.
+type ChannelStore interface {
+	GetChannel(ID string) (Channel, error)
+	PutChannel(channel Channel) error
+	ListChannels() ([]Channel, error)
+	DeleteChannel(ID string) error
+}
+
+type ErrorStoreVersion struct {
+	Version int
+}
+
+func (e *ErrorStoreVersion) Error() string {
+	return fmt.Sprintf("Store schema version %d is newer than supported version %d", e.Version, storeSchemaVersion)
+}
+
+// MemoryStore is safe for concurrent use. Users are copied on the way in and
+// out so callers never share slices with the store.
+type MemoryStore struct {
+	// HistoryLimit is the number of history entries kept per user.
+	HistoryLimit int
+	mu           sync.RWMutex
+	users        map[string]User
+	history      map[string][]HistoryEntry
+	channels     map[string]Channel
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		HistoryLimit: defaultHistoryLimit,
+		users:        make(map[string]User),
+		history:      make(map[string][]HistoryEntry),
+		channels:     make(map[string]Channel),
+	}
+}
+
+func (s *MemoryStore) Get(ID string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if user, ok := s.users[ID]; ok {
+		return user.Copy(), nil
+	}
+
+	return User{}, &ErrorUserNotFound{}
+}
+
+func (s *MemoryStore) Put(user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[user.ID] = user.Copy()
+	return nil
+}
+
+func (s *MemoryStore) List() ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user.Copy())
+	}
+
+	return users, nil
+}
+
+func (s *MemoryStore) Delete(ID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.users, ID)
+	delete(s.history, ID)
+	return nil
+}
+
+func (s *MemoryStore) AddHistory(userID string, entry HistoryEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	history := append(s.history[userID], entry)
+	if s.HistoryLimit > 0 && len(history) > s.HistoryLimit {
+		history = append([]HistoryEntry(nil), history[len(history)-s.HistoryLimit:]...)
+	}
+
+	s.history[userID] = history
+	return nil
+}
+
+func (s *MemoryStore) History(userID string) ([]HistoryEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]HistoryEntry(nil), s.history[userID]...), nil
+}
+
+func (s *MemoryStore) GetChannel(ID string) (Channel, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if channel, ok := s.channels[ID]; ok {
+		return channel.Copy(), nil
+	}
+
+	return Channel{}, &ErrorChannelNotFound{}
+}
+
+func (s *MemoryStore) PutChannel(channel Channel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.channels[channel.ID] = channel.Copy()
+	return nil
+}
+
+func (s *MemoryStore) ListChannels() ([]Channel, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	channels := make([]Channel, 0, len(s.channels))
+	for _, channel := range s.channels {
+		channels = append(channels, channel.Copy())
+	}
+
+	return channels, nil
+}
+
+func (s *MemoryStore) DeleteChannel(ID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.channels, ID)
+	delete(s.history, channelHistoryID(ID))
+	return nil
+}
+
+func (s *MemoryStore) document() storeDocument {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc := storeDocument{
+		Version:  storeSchemaVersion,
+		Users:    make(map[string]User, len(s.users)),
+		History:  make(map[string][]HistoryEntry, len(s.history)),
+		Channels: make(map[string]Channel, len(s.channels)),
+	}
+	for ID, user := range s.users {
+		doc.Users[ID] = user.Copy()
+	}
+	for ID, channel := range s.channels {
+		doc.Channels[ID] = channel.Copy()
+	}
+	for ID, history := range s.history {
+		doc.History[ID] = append([]HistoryEntry(nil), history...)
+	}
+
+	return doc
+}
+
+// storeMigrations upgrade a decoded state file one version at a time.
+// storeMigrations[0] upgrades version 1 to version 2, and so on. Append a
+// migration whenever a stored field is added, renamed or changes meaning.
+var storeMigrations = []func(doc map[string]interface{}) error{
+	migrateStoreNotifyOn,
+	migrateStoreMaxFee,
+	migrateStoreUserIDs,
+}
+
+var storeSchemaVersion = len(storeMigrations) + 1
+
+type storeDocument struct {
+	Version  int
+	Users    map[string]User
+	History  map[string][]HistoryEntry
+	Channels map[string]Channel
+}
+
+// FileStore keeps state in memory and writes a JSON document to Path after
+// every change. Writes go to a temporary file which is then renamed over the
+// original so a crash never leaves a partially written file behind.
+type FileStore struct {
+	Path string
+	*MemoryStore
+	writeMu sync.Mutex
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		Path:        path,
+		MemoryStore: NewMemoryStore(),
+	}
+
+	err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) Put(user User) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	err := s.MemoryStore.Put(user)
+	if err != nil {
+		return err
+	}
+
+	return s.save()
+}
+
+func (s *FileStore) Delete(ID string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	err := s.MemoryStore.Delete(ID)
+	if err != nil {
+		return err
+	}
+
+	return s.save()
+}
+
+func (s *FileStore) AddHistory(userID string, entry HistoryEntry) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	err := s.MemoryStore.AddHistory(userID, entry)
+	if err != nil {
+		return err
+	}
+
+	return s.save()
+}
+
+func (s *FileStore) PutChannel(channel Channel) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	err := s.MemoryStore.PutChannel(channel)
+	if err != nil {
+		return err
+	}
+
+	return s.save()
+}
+
+func (s *FileStore) DeleteChannel(ID string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	err := s.MemoryStore.DeleteChannel(ID)
+	if err != nil {
+		return err
+	}
+
+	return s.save()
+}
+
+// Close writes the state once more, in case an earlier write failed.
+func (s *FileStore) Close() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	return s.save()
+}
+
+func (s *FileStore) load() error {
+	data, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	raw := make(map[string]interface{})
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	version := 1
+	if v, ok := raw["Version"].(float64); ok {
+		version = int(v)
+	}
+
+	if version > storeSchemaVersion {
+		return &ErrorStoreVersion{Version: version}
+	}
+
+	for ; version < storeSchemaVersion; version++ {
+		err := storeMigrations[version-1](raw)
+		if err != nil {
+			return fmt.Errorf("migrating store from version %d: %w", version, err)
+		}
+	}
+	raw["Version"] = storeSchemaVersion
+
+	data, err = json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	var doc storeDocument
+	err = json.Unmarshal(data, &doc)
+	if err != nil {
+		return err
+	}
+
+	for ID, user := range doc.Users {
+		user.ID = ID
+		s.users[ID] = user
+	}
+	for ID, history := range doc.History {
+		s.history[ID] = history
+	}
+	for ID, channel := range doc.Channels {
+		channel.ID = ID
+		s.channels[ID] = channel
+	}
+
+	return nil
+}
+
+func (s *FileStore) save() error {
+	data, err := json.MarshalIndent(s.document(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(s.Path, data)
+}
+
+func storeUsers(doc map[string]interface{}) []map[string]interface{} {
+	users := make([]map[string]interface{}, 0)
+	rawUsers, _ := doc["Users"].(map[string]interface{})
+	for _, rawUser := range rawUsers {
+		if user, ok := rawUser.(map[string]interface{}); ok {
+			users = append(users, user)
+		}
+	}
+
+	return users
+}
+
+// Version 2 adds User.NotifyOn. Existing users keep being notified about new
+// islands only.
+func migrateStoreNotifyOn(doc map[string]interface{}) error {
+	for _, user := range storeUsers(doc) {
+		if _, ok := user["NotifyOn"]; !ok {
+			user["NotifyOn"] = int(defaultUserNotifyOn)
+		}
+	}
+
+	return nil
+}
+
+// Version 3 adds User.MaxFee. Existing users keep seeing islands with any fee.
+func migrateStoreMaxFee(doc map[string]interface{}) error {
+	for _, user := range storeUsers(doc) {
+		if _, ok := user["MaxFee"]; !ok {
+			user["MaxFee"] = -1
+		}
+	}
+
+	return nil
+}
+
+// Version 4 qualifies user IDs with their transport. Every user so far came
+// from Discord. Channel history is already qualified and left alone.
+func migrateStoreUserIDs(doc map[string]interface{}) error {
+	if users, ok := doc["Users"].(map[string]interface{}); ok {
+		migrated := make(map[string]interface{}, len(users))
+		for ID, rawUser := range users {
+			if transport, _ := SplitUserID(ID); transport == "" {
+				ID = UserID(NotifierDiscord, ID)
+			}
+			if user, ok := rawUser.(map[string]interface{}); ok {
+				user["ID"] = ID
+			}
+			migrated[ID] = rawUser
+		}
+		doc["Users"] = migrated
+	}
+
+	if history, ok := doc["History"].(map[string]interface{}); ok {
+		migrated := make(map[string]interface{}, len(history))
+		for ID, entries := range history {
+			if transport, _ := SplitUserID(ID); transport == "" {
+				ID = UserID(NotifierDiscord, ID)
+			}
+			migrated[ID] = entries
+		}
+		doc["History"] = migrated
+	}
+
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempStorePath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "turnipfinder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	return filepath.Join(dir, "state.json")
+}
+
+func TestFileStore(t *testing.T) {
+	testTable := []struct {
+		Name            string
+		Setup           func(store *FileStore)
+		ExpectedUsers   []User
+		ExpectedHistory map[string]int
+	}{
+		{
+			Name:          "Starts empty when the file does not exist",
+			Setup:         func(store *FileStore) {},
+			ExpectedUsers: []User{},
+		}, {
+			Name: "Persists users across reloads",
+			Setup: func(store *FileStore) {
+				store.Put(User{ID: "foo", Name: "bar", SellPrice: 500, Polling: true})
+				store.Put(User{ID: "baz", Name: "qux", BuyPrice: 90})
+			},
+			ExpectedUsers: []User{
+				{ID: "foo", Name: "bar", SellPrice: 500, Polling: true},
+				{ID: "baz", Name: "qux", BuyPrice: 90},
+			},
+		}, {
+			Name: "Persists deleted users",
+			Setup: func(store *FileStore) {
+				store.Put(User{ID: "foo", Name: "bar"})
+				store.Put(User{ID: "baz", Name: "qux"})
+				store.Delete("foo")
+			},
+			ExpectedUsers: []User{
+				{ID: "baz", Name: "qux"},
+			},
+		}, {
+			Name: "Persists notification history",
+			Setup: func(store *FileStore) {
+				store.Put(User{ID: "foo", Name: "bar"})
+				for _, island := range testIslands(3) {
+					store.AddHistory("foo", NewHistoryEntry(island, time.Now()))
+				}
+			},
+			ExpectedUsers: []User{
+				{ID: "foo", Name: "bar"},
+			},
+			ExpectedHistory: map[string]int{"foo": 3},
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			path := tempStorePath(t)
+			store, err := NewFileStore(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tcase.Setup(store)
+
+			reloaded, err := NewFileStore(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			users, _ := reloaded.List()
+			if len(users) != len(tcase.ExpectedUsers) {
+				t.Errorf("Expected to find %d users but found %d", len(tcase.ExpectedUsers), len(users))
+			}
+
+			for _, expectedUser := range tcase.ExpectedUsers {
+				user, err := reloaded.Get(expectedUser.ID)
+				if err != nil {
+					t.Errorf("Could not find user with ID %s", expectedUser.ID)
+				} else if user.Name != expectedUser.Name {
+					t.Errorf("Expected user with ID %s to have name %s but found %s", expectedUser.ID, expectedUser.Name, user.Name)
+				} else if user.SellPrice != expectedUser.SellPrice {
+					t.Errorf("Expected user with ID %s to have sell price of %d but found %d", expectedUser.ID, expectedUser.SellPrice, user.SellPrice)
+				} else if user.BuyPrice != expectedUser.BuyPrice {
+					t.Errorf("Expected user with ID %s to have buy price of %d but found %d", expectedUser.ID, expectedUser.BuyPrice, user.BuyPrice)
+				} else if user.Polling != expectedUser.Polling {
+					t.Errorf("Expected user with ID %s to have polling value of %t but found %t", expectedUser.ID, expectedUser.Polling, user.Polling)
+				}
+			}
+
+			for userID, expected := range tcase.ExpectedHistory {
+				history, _ := reloaded.History(userID)
+				if len(history) != expected {
+					t.Errorf("Expected user with ID %s to have %d history entries but found %d", userID, expected, len(history))
+				}
+			}
+
+			files, _ := ioutil.ReadDir(filepath.Dir(path))
+			for _, file := range files {
+				if file.Name() != filepath.Base(path) {
+					t.Errorf("Expected only the state file to remain but found %s", file.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestFileStoreVersion(t *testing.T) {
+	testTable := []struct {
+		Name          string
+		Contents      string
+		ExpectedError bool
+		ExpectedUser  User
+	}{
+		{
+			Name:         "Loads a file without a version as version 1",
+			Contents:     `{"Users": {"foo": {"Name": "bar", "SellPrice": 500}}}`,
+			ExpectedUser: User{ID: "discord:foo", Name: "bar", SellPrice: 500, NotifyOn: IslandAdded},
+		}, {
+			Name:         "Keeps fields that were already migrated",
+			Contents:     `{"Version": 2, "Users": {"foo": {"Name": "bar", "NotifyOn": 6}}}`,
+			ExpectedUser: User{ID: "discord:foo", Name: "bar", NotifyOn: IslandUpdated | IslandRemoved},
+		}, {
+			Name:         "Keeps user IDs that already have a transport",
+			Contents:     `{"Version": 4, "Users": {"telegram:foo": {"Name": "bar", "NotifyOn": 1}}}`,
+			ExpectedUser: User{ID: "telegram:foo", Name: "bar", NotifyOn: IslandAdded},
+		}, {
+			Name:          "Refuses a file from a newer schema",
+			Contents:      `{"Version": 9999, "Users": {}}`,
+			ExpectedError: true,
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			path := tempStorePath(t)
+			err := ioutil.WriteFile(path, []byte(tcase.Contents), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			store, err := NewFileStore(path)
+			if tcase.ExpectedError {
+				if err == nil {
+					t.Error("Expected an error to be returned")
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("Expected error to be nil but received %v", err)
+			}
+
+			user, err := store.Get(tcase.ExpectedUser.ID)
+			if err != nil {
+				t.Fatalf("Could not find user with ID %s", tcase.ExpectedUser.ID)
+			}
+			if user.Name != tcase.ExpectedUser.Name {
+				t.Errorf("Expected user to have name %q but found %q", tcase.ExpectedUser.Name, user.Name)
+			}
+			if user.SellPrice != tcase.ExpectedUser.SellPrice {
+				t.Errorf("Expected user to have sell price of %d but found %d", tcase.ExpectedUser.SellPrice, user.SellPrice)
+			}
+			if user.NotifyOn != tcase.ExpectedUser.NotifyOn {
+				t.Errorf("Expected user to be notified on %q but found %q", tcase.ExpectedUser.NotifyOn, user.NotifyOn)
+			}
+		})
+	}
+}
+
+func TestFileStoreMigrateUserIDs(t *testing.T) {
+	path := tempStorePath(t)
+	contents := `{"Version": 3, "Users": {"123": {"ID": "123", "Name": "bar"}}, "History": {"123": [{"IslandID": "a"}], "channel:9": [{"IslandID": "b"}]}}`
+	err := ioutil.WriteFile(path, []byte(contents), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Expected error to be nil but received %v", err)
+	}
+
+	user, err := store.Get("discord:123")
+	if err != nil || user.ID != "discord:123" {
+		t.Errorf("Expected the user to be moved to discord:123 but found %+v, %v", user, err)
+	}
+	if _, err := store.Get("123"); err == nil {
+		t.Error("Expected the unqualified user to be gone")
+	}
+
+	for ID, count := range map[string]int{"discord:123": 1, "123": 0, "channel:9": 1} {
+		history, _ := store.History(ID)
+		if len(history) != count {
+			t.Errorf("Expected %d history entries for %s but found %d", count, ID, len(history))
+		}
+	}
+}
+
+func TestFileStoreChannels(t *testing.T) {
+	path := tempStorePath(t)
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel := NewChannel("turnips", "guild")
+	channel.SellPrice = 500
+	channel.MentionRoleID = "123"
+	store.PutChannel(channel)
+	store.PutChannel(NewChannel("stopped", "guild"))
+	store.DeleteChannel("stopped")
+
+	reloaded, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channels, _ := reloaded.ListChannels()
+	if len(channels) != 1 {
+		t.Fatalf("Expected 1 channel but found %d", len(channels))
+	}
+	if channels[0].SellPrice != 500 || channels[0].MentionRoleID != "123" || channels[0].GuildID != "guild" {
+		t.Errorf("Expected channel %+v but found %+v", channel, channels[0])
+	}
+}
+
+func TestFileStoreClose(t *testing.T) {
+	path := tempStorePath(t)
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put(User{ID: "discord:foo", Name: "bar"})
+
+	os.Remove(path)
+	err = store.Close()
+	if err != nil {
+		t.Fatalf("Expected error to be nil but received %v", err)
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Get("discord:foo"); err != nil {
+		t.Errorf("Expected the user to be written on close but received %v", err)
+	}
+}
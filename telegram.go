@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTelegramBaseURL     = "https://api.telegram.org"
+	defaultTelegramPollTimeout = 30 * time.Second
+	defaultTelegramRetryDelay  = 5 * time.Second
+	telegramMaxText            = 4096
+)
+
+// TelegramBot receives commands by long polling getUpdates and sends
+// notifications with sendMessage. BaseURL can point at a stand-in for the
+// Bot API.
+type TelegramBot struct {
+	BaseURL     string
+	Token       string
+	Client      *http.Client
+	PollTimeout time.Duration
+	RetryDelay  time.Duration
+	offset      int64
+}
+
+type TelegramUpdate struct {
+	UpdateID int64            `json:"update_id"`
+	Message  *TelegramMessage `json:"message"`
+}
+
+type TelegramMessage struct {
+	MessageID int64         `json:"message_id"`
+	From      *TelegramUser `json:"from"`
+	Chat      TelegramChat  `json:"chat"`
+	Text      string        `json:"text"`
+}
+
+type TelegramUser struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+}
+
+type TelegramChat struct {
+	ID   int64  `json:"id"`
+	Type string `json:"type"`
+}
+
+type telegramResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+}
+
+type ErrorTelegramAPI struct {
+	Method      string
+	Code        int
+	Description string
+}
+
+func (e *ErrorTelegramAPI) Error() string {
+	return fmt.Sprintf("Telegram %s failed with %d: %s", e.Method, e.Code, e.Description)
+}
+
+func NewTelegramBot(token string) *TelegramBot {
+	return &TelegramBot{
+		BaseURL:     defaultTelegramBaseURL,
+		Token:       token,
+		Client:      http.DefaultClient,
+		PollTimeout: defaultTelegramPollTimeout,
+		RetryDelay:  defaultTelegramRetryDelay,
+	}
+}
+
+func (b *TelegramBot) Capabilities() NotifierCapabilities {
+	return NotifierCapabilities{MaxLength: telegramMaxText}
+}
+
+// Send sends a message to a chat. For users the chat ID is their user ID.
+func (b *TelegramBot) Send(ctx context.Context, recipient string, message Message) error {
+	chatID, err := strconv.ParseInt(recipient, 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid Telegram chat %q", recipient)
+	}
+
+	params := map[string]interface{}{
+		"chat_id": chatID,
+		"text":    message.Text,
+	}
+
+	return b.call(ctx, "sendMessage", params, nil)
+}
+
+// GetUpdates waits up to PollTimeout for new updates and acknowledges them so
+// they are not returned again.
+func (b *TelegramBot) GetUpdates(ctx context.Context) ([]TelegramUpdate, error) {
+	params := map[string]interface{}{
+		"offset":          b.offset,
+		"timeout":         int(b.PollTimeout / time.Second),
+		"allowed_updates": []string{"message"},
+	}
+
+	var updates []TelegramUpdate
+	err := b.call(ctx, "getUpdates", params, &updates)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, update := range updates {
+		if update.UpdateID >= b.offset {
+			b.offset = update.UpdateID + 1
+		}
+	}
+
+	return updates, nil
+}
+
+// Run handles commands sent to the bot until ctx is done.
+func (b *TelegramBot) Run(ctx context.Context, tf *TurnipFinder) error {
+	for {
+		updates, err := b.GetUpdates(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			log.Printf("Error getting Telegram updates: %v\n", err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(b.RetryDelay):
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			if update.Message != nil {
+				b.handleMessage(ctx, tf, *update.Message)
+			}
+		}
+	}
+}
+
+func (b *TelegramBot) handleMessage(ctx context.Context, tf *TurnipFinder, msg TelegramMessage) {
+	if msg.From == nil {
+		return
+	}
+
+	name, args, ok := telegramCommand(msg.Text)
+	if !ok {
+		return
+	}
+
+	userName := msg.From.Username
+	if userName == "" {
+		userName = msg.From.FirstName
+	}
+	user, err := tf.TransportUser(NotifierTelegram, strconv.FormatInt(msg.From.ID, 10), userName)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	chatID := strconv.FormatInt(msg.Chat.ID, 10)
+	reply := func(text string) error {
+		return b.Send(ctx, chatID, b.Capabilities().Adapt(TextMessage(text)))
+	}
+
+	err = tf.RunCommand(ChatCommandInput{
+		Name:      name,
+		Args:      args,
+		User:      user,
+		ChannelID: chatID,
+		Reply:     reply,
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// telegramCommand parses /sell@turnipbot 500 or !sell 500. Telegram clients
+// send /start when a user first opens the bot, which shows the help.
+func telegramCommand(text string) (string, string, bool) {
+	word, args := cutWord(text)
+	if len(word) < 2 || (word[0] != '/' && word[0] != '!') {
+		return "", "", false
+	}
+
+	name := word[1:]
+	if idx := strings.Index(name, "@"); idx >= 0 {
+		name = name[:idx]
+	}
+	if name == "start" {
+		name = "help"
+	}
+
+	return name, args, true
+}
+
+func (b *TelegramBot) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	endpoint := fmt.Sprintf("%s/bot%s/%s", b.BaseURL, b.Token, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		// Leave out the URL, which includes the token.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("Telegram %s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var data telegramResponse
+	err = json.NewDecoder(resp.Body).Decode(&data)
+	if err != nil {
+		return fmt.Errorf("Telegram %s returned status %d: %w", method, resp.StatusCode, err)
+	}
+	if !data.OK {
+		return &ErrorTelegramAPI{Method: method, Code: data.ErrorCode, Description: data.Description}
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(data.Result, result)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockTelegramAPI serves getUpdates from a queue and records sendMessage.
+type mockTelegramAPI struct {
+	mu      sync.Mutex
+	updates []TelegramUpdate
+	offsets []int64
+	sent    []map[string]interface{}
+	replied chan struct{}
+}
+
+func (api *mockTelegramAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	var params map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&params)
+
+	switch r.URL.Path {
+	case "/bottoken/getUpdates":
+		api.offsets = append(api.offsets, int64(params["offset"].(float64)))
+		result, _ := json.Marshal(api.updates)
+		api.updates = nil
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": json.RawMessage(result)})
+	case "/bottoken/sendMessage":
+		if params["chat_id"].(float64) == 403 {
+			json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error_code": 403, "description": "Forbidden: bot was blocked by the user"})
+			return
+		}
+		api.sent = append(api.sent, params)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": map[string]interface{}{}})
+		api.replied <- struct{}{}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error_code": 404, "description": "Not Found"})
+	}
+}
+
+func TestTelegramCommand(t *testing.T) {
+	testTable := []struct {
+		Text         string
+		ExpectedName string
+		ExpectedArgs string
+		ExpectedOK   bool
+	}{
+		{Text: "/sell 500", ExpectedName: "sell", ExpectedArgs: "500", ExpectedOK: true},
+		{Text: "/filter@turnipbot price > 500", ExpectedName: "filter", ExpectedArgs: "price > 500", ExpectedOK: true},
+		{Text: "!status", ExpectedName: "status", ExpectedOK: true},
+		{Text: "/start", ExpectedName: "help", ExpectedOK: true},
+		{Text: "hello"},
+		{Text: "/"},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Text, func(t *testing.T) {
+			name, args, ok := telegramCommand(tcase.Text)
+			if name != tcase.ExpectedName || args != tcase.ExpectedArgs || ok != tcase.ExpectedOK {
+				t.Errorf("Expected %q, %q, %t but received %q, %q, %t", tcase.ExpectedName, tcase.ExpectedArgs, tcase.ExpectedOK, name, args, ok)
+			}
+		})
+	}
+}
+
+func TestTelegramBotRun(t *testing.T) {
+	api := &mockTelegramAPI{
+		replied: make(chan struct{}, 10),
+		updates: []TelegramUpdate{
+			{UpdateID: 7, Message: &TelegramMessage{From: &TelegramUser{ID: 456, Username: "daisy"}, Chat: TelegramChat{ID: 456}, Text: "/sell 500"}},
+			{UpdateID: 8, Message: &TelegramMessage{From: &TelegramUser{ID: 456, Username: "daisy"}, Chat: TelegramChat{ID: 456}, Text: "just chatting"}},
+		},
+	}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	tf := New()
+	tf.RegisterDefaultCommands()
+	tf.SetUser(User{ID: "456", Name: "discord user"})
+
+	bot := NewTelegramBot("token")
+	bot.BaseURL = server.URL
+	bot.PollTimeout = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- bot.Run(ctx, tf)
+	}()
+
+	select {
+	case <-api.replied:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a reply to be sent")
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected Run to stop with context.Canceled but received %v", err)
+	}
+
+	user, err := tf.User("telegram:456")
+	if err != nil {
+		t.Fatalf("Expected the Telegram user to be added but received %v", err)
+	}
+	if user.Name != "daisy" || user.SellPrice != 500 {
+		t.Errorf("Unexpected user %+v", user)
+	}
+	other, _ := tf.User("456")
+	if other.SellPrice != 0 {
+		t.Errorf("Expected the user with the same account ID on another transport to be unchanged")
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if len(api.sent) != 1 || api.sent[0]["chat_id"].(float64) != 456 || !strings.Contains(api.sent[0]["text"].(string), "500") {
+		t.Errorf("Unexpected messages %v", api.sent)
+	}
+	if len(api.offsets) == 0 || api.offsets[0] != 0 || bot.offset != 9 {
+		t.Errorf("Expected updates to be acknowledged but offsets were %v then %d", api.offsets, bot.offset)
+	}
+}
+
+func TestTelegramBotSend(t *testing.T) {
+	api := &mockTelegramAPI{replied: make(chan struct{}, 10)}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	tf := New()
+	bot := NewTelegramBot("token")
+	bot.BaseURL = server.URL
+	tf.AddNotifier(NotifierTelegram, bot)
+
+	island := Island{Name: "Nook", TurnipPrice: 512, URL: "https://example.com/island/1"}
+	err := tf.SendUserMessage(User{ID: "telegram:456"}, tf.RenderIslandMessage(island, FormatCompact, ""))
+	if err != nil {
+		t.Fatalf("Expected error to be nil but received %v", err)
+	}
+	if len(api.sent) != 1 || api.sent[0]["text"] != "512 bells — https://example.com/island/1" {
+		t.Errorf("Unexpected messages %v", api.sent)
+	}
+
+	err = bot.Send(context.Background(), "403", TextMessage("hello"))
+	var apiErr *ErrorTelegramAPI
+	if !errors.As(err, &apiErr) || apiErr.Code != 403 {
+		t.Errorf("Expected ErrorTelegramAPI but received %v", err)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+const (
+	FormatFull    = "full"
+	FormatCompact = "compact"
+	FormatMobile  = "mobile"
+
+	maxFormatLength = 1000
+	maxFormatOutput = 2000
+)
+
+// formatPresets are the built in notification templates. Only the full
+// format is also sent as an embed, so the other formats look the same on
+// every transport.
+var formatPresets = map[string]string{
+	FormatFull:    "{{.Prefix}}[{{.Queue}}/{{.MaxQueue}}] {{.Name}} \tPrice: {{.Price}}\nURL: {{.URL}}\nFee: {{.Fee}}\n{{.Description}}\n",
+	FormatCompact: "{{.Prefix}}{{.Price}} bells — {{.URL}}",
+	FormatMobile:  "{{.Prefix}}{{.Name}}\n{{.Price}} bells · {{queueBar .Queue .MaxQueue}} · fee {{fee .Fee}}\n{{.URL}}",
+}
+
+// FormatPresets returns the names of the built in formats.
+func FormatPresets() []string {
+	names := make([]string, 0, len(formatPresets))
+	for name := range formatPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// IslandTemplateData is all a notification template can see. It only holds
+// plain values so templates cannot reach anything else.
+type IslandTemplateData struct {
+	// Prefix names the watch and event, like "[sell-high] Updated: ".
+	Prefix      string
+	Name        string
+	Price       int
+	Queue       int
+	MaxQueue    int
+	Fee         int
+	URL         string
+	Description string
+	Islander    string
+	Category    string
+	Hemisphere  string
+	Listing     string
+	// Age is how long ago the island was listed, in minutes.
+	Age int
+}
+
+func NewIslandTemplateData(island Island, prefix string, now time.Time) IslandTemplateData {
+	return IslandTemplateData{
+		Prefix:      prefix,
+		Name:        island.Name,
+		Price:       island.TurnipPrice,
+		Queue:       island.InQueue,
+		MaxQueue:    island.MaxQueue,
+		Fee:         island.Fee,
+		URL:         island.URL,
+		Description: island.Description,
+		Islander:    island.Islander,
+		Category:    island.Category,
+		Hemisphere:  island.Hemisphere,
+		Listing:     island.Listing.String(),
+		Age:         int(IslandAge(island, now) / time.Minute),
+	}
+}
+
+var templateFuncs = template.FuncMap{
+	"printf":   templatePrintf,
+	"queueBar": QueueBar,
+	"fee":      renderFee,
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"trim":     strings.TrimSpace,
+	"truncate": func(length int, s string) string {
+		return truncateText(s, length)
+	},
+}
+
+// templatePrintfWidth matches the width and precision of a printf verb.
+var templatePrintfWidth = regexp.MustCompile(`%[-+# 0]*(?:\[\d+\])?(\d*)(?:\.(?:\[\d+\])?(\d*))?`)
+
+// templatePrintf replaces the printf builtin, which would pad its output to
+// any width before the output limit could stop it.
+func templatePrintf(format string, args ...interface{}) (string, error) {
+	if strings.Contains(format, "*") {
+		return "", fmt.Errorf("printf widths must be numbers")
+	}
+	for _, match := range templatePrintfWidth.FindAllStringSubmatch(format, -1) {
+		for _, size := range match[1:] {
+			if n, err := strconv.Atoi(size); size != "" && (err != nil || n > maxFormatOutput) {
+				return "", &ErrorFormatOutput{}
+			}
+		}
+	}
+
+	return fmt.Sprintf(format, args...), nil
+}
+
+type ErrorFormatOutput struct{}
+
+func (e *ErrorFormatOutput) Error() string {
+	return fmt.Sprintf("Templates can produce at most %d characters", maxFormatOutput)
+}
+
+// formatWriter fails once more than maxFormatOutput bytes are written, which
+// stops the template executing.
+type formatWriter struct {
+	out bytes.Buffer
+}
+
+func (w *formatWriter) Write(p []byte) (int, error) {
+	if w.out.Len()+len(p) > maxFormatOutput {
+		return 0, &ErrorFormatOutput{}
+	}
+
+	return w.out.Write(p)
+}
+
+// executeIslandTemplate renders a template within the output limit.
+func executeIslandTemplate(tmpl *template.Template, data IslandTemplateData) (string, error) {
+	var w formatWriter
+	err := tmpl.Execute(&w, data)
+	if err != nil {
+		return "", err
+	}
+
+	return w.out.String(), nil
+}
+
+// checkTemplateNode rejects range and template actions. Templates only see
+// plain values, so range is only good for looping over numbers and template
+// for recursion, which both let a short template run for as long as it likes.
+func checkTemplateNode(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			err := checkTemplateNode(child)
+			if err != nil {
+				return err
+			}
+		}
+	case *parse.IfNode:
+		return checkTemplateBranch(&n.BranchNode)
+	case *parse.WithNode:
+		return checkTemplateBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		return fmt.Errorf("Templates cannot use range")
+	case *parse.TemplateNode:
+		return fmt.Errorf("Templates cannot use template or block")
+	}
+
+	return nil
+}
+
+func checkTemplateBranch(branch *parse.BranchNode) error {
+	err := checkTemplateNode(branch.List)
+	if err != nil {
+		return err
+	}
+
+	return checkTemplateNode(branch.ElseList)
+}
+
+var sampleTemplateIsland = Island{
+	Name:        "Nook",
+	TurnipPrice: 523,
+	InQueue:     4,
+	MaxQueue:    20,
+	URL:         "https://turnip.exchange/island/abc123",
+	Description: "Tips appreciated",
+	Islander:    "neither",
+	Category:    "turnips",
+	Hemisphere:  "north",
+}
+
+// ParseIslandTemplate parses a preset name or a custom template and checks it
+// by rendering a sample island. Templates may not loop or recurse.
+func ParseIslandTemplate(format string) (*template.Template, error) {
+	source, ok := formatPresets[strings.ToLower(format)]
+	if !ok {
+		source = format
+	}
+
+	if len(source) > maxFormatLength {
+		return nil, fmt.Errorf("Templates can be at most %d characters long", maxFormatLength)
+	}
+
+	tmpl, err := template.New("island").Funcs(templateFuncs).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, defined := range tmpl.Templates() {
+		err = checkTemplateNode(defined.Tree.Root)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	out, err := executeIslandTemplate(tmpl, NewIslandTemplateData(sampleTemplateIsland, "", time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(out) == "" {
+		return nil, fmt.Errorf("Templates must produce some text")
+	}
+
+	return tmpl, nil
+}
+
+// cachedTemplate is a compiled custom format and the source it came from.
+type cachedTemplate struct {
+	source string
+	tmpl   *template.Template
+}
+
+// islandTemplate returns the compiled template for a format, falling back to
+// the full format if it cannot be used. Presets are compiled once. A custom
+// format is cached under key, one per user or channel, until it changes;
+// without a key it is compiled every time.
+func (tf *TurnipFinder) islandTemplate(key string, format string) *template.Template {
+	if format == "" {
+		format = FormatFull
+	}
+	if tmpl, ok := formatPresetTemplates[strings.ToLower(format)]; ok {
+		return tmpl
+	}
+
+	tf.mu.RLock()
+	cached, ok := tf.templates[key]
+	tf.mu.RUnlock()
+	if ok && cached.source == format {
+		return cached.tmpl
+	}
+
+	tmpl, err := ParseIslandTemplate(format)
+	if err != nil {
+		log.Printf("Invalid format %q: %v\n", format, err)
+		tmpl = formatPresetFull
+	}
+
+	if key != "" {
+		tf.mu.Lock()
+		tf.templates[key] = cachedTemplate{source: format, tmpl: tmpl}
+		tf.mu.Unlock()
+	}
+
+	return tmpl
+}
+
+// RenderIslandMessage renders an island notification in a format. The full
+// format includes an embed for transports that support them. Islands the
+// format cannot render within the output limit are sent in the full format.
+func (tf *TurnipFinder) RenderIslandMessage(island Island, format string, prefix string) Message {
+	return tf.renderIslandMessage("", island, format, prefix)
+}
+
+// renderIslandMessage is RenderIslandMessage with a custom format cached
+// under key.
+func (tf *TurnipFinder) renderIslandMessage(key string, island Island, format string, prefix string) Message {
+	data := NewIslandTemplateData(island, prefix, tf.now())
+	text, err := executeIslandTemplate(tf.islandTemplate(key, format), data)
+	if err != nil {
+		log.Printf("Error rendering island %s with format %q: %v\n", island.ID, format, err)
+		var out bytes.Buffer
+		formatPresetFull.Execute(&out, data)
+		text = out.String()
+	}
+
+	msg := Message{Text: text}
+	if format == "" || format == FormatFull {
+		msg.Embed = RenderIslandEmbed(island, prefix)
+	}
+
+	return msg
+}
+
+var formatPresetTemplates = parseFormatPresets()
+
+var formatPresetFull = formatPresetTemplates[FormatFull]
+
+func parseFormatPresets() map[string]*template.Template {
+	templates := make(map[string]*template.Template, len(formatPresets))
+	for name := range formatPresets {
+		templates[name] = template.Must(ParseIslandTemplate(name))
+	}
+
+	return templates
+}
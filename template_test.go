@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseIslandTemplate(t *testing.T) {
+	testTable := []struct {
+		Name          string
+		Format        string
+		ExpectedError string
+	}{
+		{
+			Name:   "Parses presets",
+			Format: FormatMobile,
+		}, {
+			Name:   "Parses presets ignoring case",
+			Format: "Compact",
+		}, {
+			Name:   "Parses custom templates with helpers",
+			Format: "{{upper .Name}} {{.Price}} {{queueBar .Queue .MaxQueue}} {{truncate 5 .Description}}",
+		}, {
+			Name:          "Rejects unknown fields",
+			Format:        "{{.Password}}",
+			ExpectedError: "can't evaluate field Password",
+		}, {
+			Name:          "Rejects unknown functions",
+			Format:        "{{exec .Name}}",
+			ExpectedError: `function "exec" not defined`,
+		}, {
+			Name:          "Rejects invalid syntax",
+			Format:        "{{.Price",
+			ExpectedError: "unclosed action",
+		}, {
+			Name:          "Rejects empty output",
+			Format:        "{{if false}}x{{end}}",
+			ExpectedError: "must produce some text",
+		}, {
+			Name:          "Rejects long templates",
+			Format:        strings.Repeat("x", maxFormatLength+1),
+			ExpectedError: "at most",
+		}, {
+			Name:          "Rejects long output",
+			Format:        strings.Repeat("{{.URL}}", 100),
+			ExpectedError: "can produce at most",
+		}, {
+			Name:          "Rejects range before running it",
+			Format:        "{{range 20000000}}{{$.Name}}{{end}}",
+			ExpectedError: "cannot use range",
+		}, {
+			Name:          "Rejects range nested in other actions",
+			Format:        "{{if .Name}}{{with .Price}}{{else}}{{range .Price}}x{{end}}{{end}}{{end}}",
+			ExpectedError: "cannot use range",
+		}, {
+			Name:          "Rejects recursive templates",
+			Format:        `{{define "x"}}{{template "x" .}}{{end}}{{template "x" .}}`,
+			ExpectedError: "cannot use template",
+		}, {
+			Name:   "Allows printf",
+			Format: `{{printf "%5d bells" .Price}}`,
+		}, {
+			Name:          "Rejects wide printf padding",
+			Format:        `{{printf "%999999999d" .Price}}`,
+			ExpectedError: "can produce at most",
+		}, {
+			Name:          "Rejects printf widths from arguments",
+			Format:        `{{printf "%*d" 999999999 .Price}}`,
+			ExpectedError: "widths must be numbers",
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			_, err := ParseIslandTemplate(tcase.Format)
+			if tcase.ExpectedError == "" && err != nil {
+				t.Errorf("Expected error to be nil but received %v", err)
+			}
+			if tcase.ExpectedError != "" && (err == nil || !strings.Contains(err.Error(), tcase.ExpectedError)) {
+				t.Errorf("Expected error containing %q but received %v", tcase.ExpectedError, err)
+			}
+		})
+	}
+}
+
+func TestRenderIslandMessage(t *testing.T) {
+	tf := New()
+	island := Island{
+		Name:        "Nook",
+		TurnipPrice: 512,
+		InQueue:     4,
+		MaxQueue:    20,
+		URL:         "https://example.com/island/1",
+		Description: "Tips appreciated",
+	}
+
+	testTable := []struct {
+		Format        string
+		ExpectedText  string
+		ExpectedEmbed bool
+	}{
+		{
+			Format:        "",
+			ExpectedText:  "[sell-high] Updated: [4/20] Nook \tPrice: 512\nURL: https://example.com/island/1\nFee: 0\nTips appreciated\n",
+			ExpectedEmbed: true,
+		}, {
+			Format:       FormatCompact,
+			ExpectedText: "[sell-high] Updated: 512 bells — https://example.com/island/1",
+		}, {
+			Format:       FormatMobile,
+			ExpectedText: "[sell-high] Updated: Nook\n512 bells · ▰▰▱▱▱▱▱▱▱▱ 4/20 · fee None\nhttps://example.com/island/1",
+		}, {
+			Format:       "{{lower .Name}} sells at {{.Price}}",
+			ExpectedText: "nook sells at 512",
+		}, {
+			Format:       "x{{with .Prefix}}" + strings.Repeat("{{.}}", 100) + "{{end}}",
+			ExpectedText: "[sell-high] Updated: [4/20] Nook \tPrice: 512\nURL: https://example.com/island/1\nFee: 0\nTips appreciated\n",
+		}, {
+			Format:        "{{.Missing}}",
+			ExpectedText:  "[sell-high] Updated: [4/20] Nook \tPrice: 512\nURL: https://example.com/island/1\nFee: 0\nTips appreciated\n",
+			ExpectedEmbed: false,
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Format, func(t *testing.T) {
+			msg := tf.RenderIslandMessage(island, tcase.Format, "[sell-high] Updated: ")
+			if msg.Text != tcase.ExpectedText {
+				t.Errorf("Expected text %q but received %q", tcase.ExpectedText, msg.Text)
+			}
+			if (msg.Embed != nil) != tcase.ExpectedEmbed {
+				t.Errorf("Expected embed to be %t but received %+v", tcase.ExpectedEmbed, msg.Embed)
+			}
+		})
+	}
+}
+
+func TestIslandTemplateCache(t *testing.T) {
+	tf := New()
+	island := Island{Name: "Nook", TurnipPrice: 512}
+
+	tf.renderIslandMessage("user", island, "a {{.Price}}", "")
+	msg := tf.renderIslandMessage("user", island, "b {{.Price}}", "")
+	if msg.Text != "b 512" {
+		t.Errorf("Expected the changed format to be used but received %q", msg.Text)
+	}
+
+	tf.renderIslandMessage("other", island, FormatCompact, "")
+	tf.RenderIslandMessage(island, "c {{.Price}}", "")
+	if len(tf.templates) != 1 || tf.templates["user"].source != "b {{.Price}}" {
+		t.Errorf("Expected one cached template for the user's latest format but found %v", tf.templates)
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/bmonds/turnipfinder/client/turnipexchange"
 	"log"
@@ -10,9 +12,26 @@ import (
 	"time"
 )
 
+const defaultTurnipExchangeInterval = 10 * time.Second
+
+type ErrorTurnipExchangeRateLimitHeader struct {
+	Err error
+}
+
+func (e *ErrorTurnipExchangeRateLimitHeader) Error() string {
+	return fmt.Sprintf("Invalid Turnip Exchange rate limit headers, waiting %s: %v", defaultTurnipExchangeInterval, e.Err)
+}
+
+func (e *ErrorTurnipExchangeRateLimitHeader) Unwrap() error {
+	return e.Err
+}
+
 type TurnipExchangeSource struct {
 	client        *turnipexchange.Client
 	lastRateLimit TurnipExchangeRateLimit
+	// nextListing is where the next run starts in the list of listings, so
+	// listings skipped for the rate limit are fetched first next time.
+	nextListing int
 }
 
 type TurnipExchangeRateLimit struct {
@@ -28,17 +47,22 @@ func NewTurnipExchangeSource() *TurnipExchangeSource {
 	}
 }
 
+var turnipExchangeQueuedRegex = regexp.MustCompile(`^(\d+)/(\d+)$`)
+
+// ToIsland converts an API island. A missing or malformed Queued field is
+// logged and leaves InQueue at -1.
 func (t *TurnipExchangeSource) ToIsland(island turnipexchange.Island) Island {
 	inQueue := -1
-	regex := regexp.MustCompile(`^(\d+)/(\d+)$`)
-	match := regex.FindStringSubmatch(island.Queued)
+	match := turnipExchangeQueuedRegex.FindStringSubmatch(island.Queued)
 	if len(match) == 3 {
 		val, err := strconv.Atoi(match[1])
 		if err != nil {
-			log.Fatal(err)
+			log.Printf("Turnip Exchange island %s has an invalid queue %q: %v\n", island.TurnipCode, island.Queued, err)
+		} else {
+			inQueue = val
 		}
-
-		inQueue = val
+	} else {
+		log.Printf("Turnip Exchange island %s has an invalid queue %q\n", island.TurnipCode, island.Queued)
 	}
 
 	return Island{
@@ -50,35 +74,41 @@ func (t *TurnipExchangeSource) ToIsland(island turnipexchange.Island) Island {
 		Fee:         island.Fee,
 		Islander:    island.Islander,
 		Category:    island.Category,
+		Hemisphere:  island.Hemisphere,
 		CreateTime:  island.CreateTime,
 		Description: island.Description,
 		InQueue:     inQueue,
 	}
 }
 
-func (t *TurnipExchangeSource) SetTurnipExchangeRateLimit(headers http.Header) {
-	limit, err := strconv.Atoi(headers.Get("X-Ratelimit-Limit"))
-	if err != nil {
-		log.Fatal(err)
-	}
+// SetTurnipExchangeRateLimit reads the X-Ratelimit-* headers. When a header
+// is missing or malformed the source waits defaultTurnipExchangeInterval
+// before the next request and the parse error is returned.
+func (t *TurnipExchangeSource) SetTurnipExchangeRateLimit(headers http.Header) error {
+	now := time.Now().Unix()
 
-	remaining, err := strconv.Atoi(headers.Get("X-Ratelimit-Remaining"))
-	if err != nil {
-		log.Fatal(err)
-	}
+	limit, errLimit := strconv.Atoi(headers.Get("X-Ratelimit-Limit"))
+	remaining, errRemaining := strconv.Atoi(headers.Get("X-Ratelimit-Remaining"))
+	reset, errReset := strconv.ParseInt(headers.Get("X-Ratelimit-Reset"), 10, 64)
+	for _, err := range []error{errLimit, errRemaining, errReset} {
+		if err != nil {
+			fallback := now + int64(defaultTurnipExchangeInterval/time.Second)
+			t.lastRateLimit = TurnipExchangeRateLimit{
+				Limit:     limit,
+				Remaining: 1,
+				Reset:     fallback,
+				Next:      fallback,
+			}
 
-	reset, err := strconv.ParseInt(headers.Get("X-Ratelimit-Reset"), 10, 64)
-	if err != nil {
-		log.Fatal(err)
+			return &ErrorTurnipExchangeRateLimitHeader{Err: err}
+		}
 	}
 
 	next := reset
 	if remaining > 0 {
-		now := time.Now()
-		epoch := now.Unix()
-		diff := reset - epoch
+		diff := reset - now
 		secondsPer := diff / int64(remaining)
-		next = epoch + secondsPer
+		next = now + secondsPer
 	}
 
 	t.lastRateLimit = TurnipExchangeRateLimit{
@@ -87,6 +117,8 @@ func (t *TurnipExchangeSource) SetTurnipExchangeRateLimit(headers http.Header) {
 		Reset:     reset,
 		Next:      next,
 	}
+
+	return nil
 }
 
 func (t *TurnipExchangeSource) TurnipExchangeIsRateLimited() bool {
@@ -104,29 +136,125 @@ func (t *TurnipExchangeSource) TurnipExchangeIsRateLimited() bool {
 	return false
 }
 
-func (t *TurnipExchangeSource) Run() []Island {
+var turnipExchangeCategories = map[Listing]string{
+	ListingSell: turnipexchange.CategoryTurnips,
+	ListingBuy:  turnipexchange.CategoryDaisy,
+}
+
+func (t *TurnipExchangeSource) Run(ctx context.Context) ([]Island, error) {
+	islands, _, err := t.RunPartial(ctx)
+	return islands, err
+}
+
+// RunPartial queries the listings the polling users need. Once a request uses
+// up the rate limit the remaining listings are left for the following runs,
+// which start with them, and the coverage only includes what was fetched.
+func (t *TurnipExchangeSource) RunPartial(ctx context.Context) ([]Island, IslandCoverage, error) {
 	islands := make([]Island, 0)
+	fee := t.fee(ctx)
+	fetched := make(map[Listing]bool)
+	covered := func(island Island) bool {
+		return fetched[island.Listing] && (fee == turnipexchange.FeeAny || island.Fee == 0)
+	}
 
 	if t.TurnipExchangeIsRateLimited() {
-		return islands
+		retryAfter := time.Until(time.Unix(t.lastRateLimit.Next, 0))
+		return islands, covered, &ErrorSourceRateLimited{Err: errors.New("waiting for rate limit"), RetryAfter: retryAfter}
 	}
 
-	teIslands, resp, err := t.client.Islands("neither", "turnips", 0)
-	if err != nil {
-		if _, ok := err.(*turnipexchange.ErrorTryLater); !ok {
-			log.Fatal(err)
+	listings := t.listings(ctx)
+	start := t.nextListing % len(listings)
+	seen := make(map[string]bool)
+	for idx := range listings {
+		if idx > 0 && t.TurnipExchangeIsRateLimited() {
+			break
+		}
+
+		listing := listings[(start+idx)%len(listings)]
+		teIslands, err := t.fetch(ctx, turnipExchangeCategories[listing], fee)
+		if err != nil {
+			return islands, covered, err
+		}
+		fetched[listing] = true
+		t.nextListing = start + idx + 1
+
+		for _, teIsland := range teIslands {
+			if seen[teIsland.TurnipCode] {
+				continue
+			}
+
+			seen[teIsland.TurnipCode] = true
+			island := t.ToIsland(teIsland)
+			island.Listing = listing
+			islands = append(islands, island)
 		}
 	}
 
+	return islands, covered, nil
+}
+
+func (t *TurnipExchangeSource) listings(ctx context.Context) []Listing {
+	query, ok := SourceQueryFromContext(ctx)
+	if !ok || len(query.Listings) == 0 {
+		return []Listing{ListingSell}
+	}
+
+	return query.Listings
+}
+
+// fee returns the fee filter to request. FeeAny includes islands without a
+// fee, so it is used whenever anyone accepts fees and FeeFilter sorts out the
+// users who do not.
+func (t *TurnipExchangeSource) fee(ctx context.Context) int {
+	query, ok := SourceQueryFromContext(ctx)
+	if ok && query.NoFee && !query.AnyFee {
+		return turnipexchange.FeeNone
+	}
+
+	return turnipexchange.FeeAny
+}
+
+func (t *TurnipExchangeSource) fetch(ctx context.Context, category string, fee int) ([]turnipexchange.Island, error) {
+	teIslands, resp, err := t.client.Islands(ctx, "neither", category, fee)
 	if resp != nil {
-		t.SetTurnipExchangeRateLimit(resp.Header)
+		headerErr := t.SetTurnipExchangeRateLimit(resp.Header)
+		if headerErr != nil {
+			log.Println(headerErr)
+		}
+	}
+
+	if err != nil {
+		return nil, t.classifyError(err)
 	}
 
-	for _, island := range teIslands {
-		islands = append(islands, t.ToIsland(island))
+	return teIslands, nil
+}
+
+// turnipExchangeFatalStatuses mean the source is set up wrong and will not
+// recover by itself. Any other status is retried, as the site may only be
+// refusing requests for a while.
+var turnipExchangeFatalStatuses = map[int]bool{
+	http.StatusUnauthorized: true,
+	http.StatusNotFound:     true,
+	http.StatusGone:         true,
+}
+
+func (t *TurnipExchangeSource) classifyError(err error) error {
+	switch e := err.(type) {
+	case *turnipexchange.ErrorTryLater:
+		retryAfter := time.Until(time.Unix(t.lastRateLimit.Reset, 0))
+		if seconds, parseErr := strconv.Atoi(e.Response.Header.Get("Retry-After")); parseErr == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+
+		return &ErrorSourceRateLimited{Err: err, RetryAfter: retryAfter}
+	case *turnipexchange.ErrorUnexpectedStatus:
+		if turnipExchangeFatalStatuses[e.StatusCode] {
+			return &ErrorSourceFatal{Err: err}
+		}
 	}
 
-	return islands
+	return &ErrorSourceTransient{Err: err}
 }
 
 func (t *TurnipExchangeSource) Name() string {
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bmonds/turnipfinder/client/turnipexchange"
+)
+
+func turnipExchangeHeaders(remaining int) map[string]string {
+	return map[string]string{
+		"X-Ratelimit-Limit":     "100",
+		"X-Ratelimit-Remaining": strconv.Itoa(remaining),
+		"X-Ratelimit-Reset":     strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10),
+	}
+}
+
+func TestTurnipExchangeSourceRun(t *testing.T) {
+	isTransient := func(err error) bool {
+		var e *ErrorSourceTransient
+		return errors.As(err, &e)
+	}
+	isRateLimited := func(err error) bool {
+		var e *ErrorSourceRateLimited
+		return errors.As(err, &e)
+	}
+	isFatal := func(err error) bool {
+		var e *ErrorSourceFatal
+		return errors.As(err, &e)
+	}
+
+	testTable := []struct {
+		Name                string
+		Fixture             string
+		Status              int
+		Headers             map[string]string
+		ExpectedQueues      []int
+		ExpectedError       func(error) bool
+		ExpectedRateLimited bool
+	}{
+		{
+			Name:           "Converts a recorded response",
+			Fixture:        "islands.json",
+			Status:         http.StatusOK,
+			Headers:        turnipExchangeHeaders(100),
+			ExpectedQueues: []int{4, 10},
+		}, {
+			Name:           "Defaults malformed queue values",
+			Fixture:        "islands_malformed_queue.json",
+			Status:         http.StatusOK,
+			Headers:        turnipExchangeHeaders(100),
+			ExpectedQueues: []int{-1, -1},
+		}, {
+			Name:                "Waits after missing rate limit headers",
+			Fixture:             "islands.json",
+			Status:              http.StatusOK,
+			Headers:             map[string]string{},
+			ExpectedQueues:      []int{4, 10},
+			ExpectedRateLimited: true,
+		}, {
+			Name:    "Waits after malformed rate limit headers",
+			Fixture: "islands.json",
+			Status:  http.StatusOK,
+			Headers: map[string]string{
+				"X-Ratelimit-Limit":     "sixty",
+				"X-Ratelimit-Remaining": "",
+				"X-Ratelimit-Reset":     "soon",
+			},
+			ExpectedQueues:      []int{4, 10},
+			ExpectedRateLimited: true,
+		}, {
+			Name:                "Reports too many requests as rate limited",
+			Fixture:             "not_success.json",
+			Status:              http.StatusTooManyRequests,
+			Headers:             turnipExchangeHeaders(0),
+			ExpectedError:       isRateLimited,
+			ExpectedRateLimited: true,
+		}, {
+			Name:          "Reports an unsuccessful response as transient",
+			Fixture:       "not_success.json",
+			Status:        http.StatusOK,
+			Headers:       turnipExchangeHeaders(100),
+			ExpectedError: isTransient,
+		}, {
+			Name:          "Reports an invalid body as transient",
+			Fixture:       "invalid.json",
+			Status:        http.StatusOK,
+			Headers:       turnipExchangeHeaders(100),
+			ExpectedError: isTransient,
+		}, {
+			Name:          "Reports a server error as transient",
+			Fixture:       "invalid.json",
+			Status:        http.StatusBadGateway,
+			Headers:       turnipExchangeHeaders(100),
+			ExpectedError: isTransient,
+		}, {
+			Name:          "Reports a refused request as transient",
+			Fixture:       "invalid.json",
+			Status:        http.StatusForbidden,
+			Headers:       turnipExchangeHeaders(100),
+			ExpectedError: isTransient,
+		}, {
+			Name:          "Reports a request timeout as transient",
+			Fixture:       "invalid.json",
+			Status:        http.StatusRequestTimeout,
+			Headers:       turnipExchangeHeaders(100),
+			ExpectedError: isTransient,
+		}, {
+			Name:          "Reports an unauthorized request as fatal",
+			Fixture:       "invalid.json",
+			Status:        http.StatusUnauthorized,
+			Headers:       turnipExchangeHeaders(100),
+			ExpectedError: isFatal,
+		}, {
+			Name:          "Reports a missing endpoint as fatal",
+			Fixture:       "invalid.json",
+			Status:        http.StatusNotFound,
+			Headers:       turnipExchangeHeaders(100),
+			ExpectedError: isFatal,
+		},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			body, err := ioutil.ReadFile(filepath.Join("testdata", "turnipexchange", tcase.Fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for key, value := range tcase.Headers {
+					w.Header().Set(key, value)
+				}
+				w.WriteHeader(tcase.Status)
+				w.Write(body)
+			}))
+			defer server.Close()
+
+			source := NewTurnipExchangeSource()
+			source.client.BaseURL = server.URL
+
+			islands, err := source.Run(context.Background())
+			if tcase.ExpectedError == nil && err != nil {
+				t.Errorf("Expected error to be nil but received %v", err)
+			} else if tcase.ExpectedError != nil && !tcase.ExpectedError(err) {
+				t.Errorf("Received an unexpected error: %v", err)
+			}
+
+			if len(islands) != len(tcase.ExpectedQueues) {
+				t.Fatalf("Expected %d islands but received %d", len(tcase.ExpectedQueues), len(islands))
+			}
+
+			for idx, expected := range tcase.ExpectedQueues {
+				if islands[idx].InQueue != expected {
+					t.Errorf("Expected island[%d] to have %d in queue but found %d", idx, expected, islands[idx].InQueue)
+				}
+				if islands[idx].ID == "" || islands[idx].URL == "" {
+					t.Errorf("Expected island[%d] to have an ID and URL", idx)
+				}
+			}
+
+			if source.TurnipExchangeIsRateLimited() != tcase.ExpectedRateLimited {
+				t.Errorf("Expected rate limited to be %t", tcase.ExpectedRateLimited)
+			}
+		})
+	}
+}
+
+func TestTurnipExchangeSourceFeeVariants(t *testing.T) {
+	testTable := []struct {
+		Name         string
+		Query        *SourceQuery
+		ExpectedFees []int
+	}{
+		{
+			Name:         "Queries any fee without a query",
+			ExpectedFees: []int{turnipexchange.FeeAny},
+		}, {
+			Name:         "Queries any fee when users accept fees",
+			Query:        &SourceQuery{AnyFee: true},
+			ExpectedFees: []int{turnipexchange.FeeAny},
+		}, {
+			Name:         "Queries only islands without fees when nobody accepts fees",
+			Query:        &SourceQuery{NoFee: true},
+			ExpectedFees: []int{turnipexchange.FeeNone},
+		}, {
+			Name:         "Queries only any fee for mixed users",
+			Query:        &SourceQuery{AnyFee: true, NoFee: true},
+			ExpectedFees: []int{turnipexchange.FeeAny},
+		},
+	}
+
+	body, err := ioutil.ReadFile(filepath.Join("testdata", "turnipexchange", "islands.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			fees := make([]int, 0)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req turnipexchange.IslandsRequest
+				json.NewDecoder(r.Body).Decode(&req)
+				fees = append(fees, req.Fee)
+
+				for key, value := range turnipExchangeHeaders(100) {
+					w.Header().Set(key, value)
+				}
+				w.Write(body)
+			}))
+			defer server.Close()
+
+			source := NewTurnipExchangeSource()
+			source.client.BaseURL = server.URL
+
+			ctx := context.Background()
+			if tcase.Query != nil {
+				ctx = WithSourceQuery(ctx, *tcase.Query)
+			}
+
+			islands, err := source.Run(ctx)
+			if err != nil {
+				t.Fatalf("Expected error to be nil but received %v", err)
+			}
+			if len(islands) != 2 {
+				t.Errorf("Expected 2 islands but received %d", len(islands))
+			}
+
+			if len(fees) != len(tcase.ExpectedFees) {
+				t.Fatalf("Expected %d requests but received %d", len(tcase.ExpectedFees), len(fees))
+			}
+			for idx, expected := range tcase.ExpectedFees {
+				if fees[idx] != expected {
+					t.Errorf("Expected request[%d] to use fee %d but found %d", idx, expected, fees[idx])
+				}
+			}
+		})
+	}
+}
+
+func TestTurnipExchangeSourceListings(t *testing.T) {
+	testTable := []struct {
+		Name               string
+		Listings           []Listing
+		ExpectedCategories []string
+		ExpectedListing    Listing
+	}{
+		{
+			Name:               "Queries turnip prices by default",
+			ExpectedCategories: []string{turnipexchange.CategoryTurnips},
+			ExpectedListing:    ListingSell,
+		}, {
+			Name:               "Queries Daisy Mae for buying users",
+			Listings:           []Listing{ListingBuy},
+			ExpectedCategories: []string{turnipexchange.CategoryDaisy},
+			ExpectedListing:    ListingBuy,
+		}, {
+			Name:               "Queries both categories for mixed users",
+			Listings:           []Listing{ListingSell, ListingBuy},
+			ExpectedCategories: []string{turnipexchange.CategoryTurnips, turnipexchange.CategoryDaisy},
+			ExpectedListing:    ListingSell,
+		},
+	}
+
+	body, err := ioutil.ReadFile(filepath.Join("testdata", "turnipexchange", "islands.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.Name, func(t *testing.T) {
+			categories := make([]string, 0)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req turnipexchange.IslandsRequest
+				json.NewDecoder(r.Body).Decode(&req)
+				categories = append(categories, req.Category)
+
+				for key, value := range turnipExchangeHeaders(100) {
+					w.Header().Set(key, value)
+				}
+				w.Write(body)
+			}))
+			defer server.Close()
+
+			source := NewTurnipExchangeSource()
+			source.client.BaseURL = server.URL
+
+			ctx := WithSourceQuery(context.Background(), SourceQuery{AnyFee: true, Listings: tcase.Listings})
+			islands, err := source.Run(ctx)
+			if err != nil {
+				t.Fatalf("Expected error to be nil but received %v", err)
+			}
+
+			if len(categories) != len(tcase.ExpectedCategories) {
+				t.Fatalf("Expected %d requests but received %d", len(tcase.ExpectedCategories), len(categories))
+			}
+			for idx, expected := range tcase.ExpectedCategories {
+				if categories[idx] != expected {
+					t.Errorf("Expected request[%d] to use category %q but found %q", idx, expected, categories[idx])
+				}
+			}
+
+			for _, island := range islands {
+				if island.Listing != tcase.ExpectedListing {
+					t.Errorf("Expected island %s to be a %s listing but found %s", island.ID, tcase.ExpectedListing, island.Listing)
+				}
+			}
+		})
+	}
+}
+
+func TestTurnipExchangeSourceRateLimitedListings(t *testing.T) {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", "turnipexchange", "islands.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	categories := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req turnipexchange.IslandsRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		categories = append(categories, req.Category)
+
+		// 29 requests left in the next minute allows one every two seconds.
+		w.Header().Set("X-Ratelimit-Limit", "30")
+		w.Header().Set("X-Ratelimit-Remaining", "29")
+		w.Header().Set("X-Ratelimit-Reset", strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	source := NewTurnipExchangeSource()
+	source.client.BaseURL = server.URL
+	ctx := WithSourceQuery(context.Background(), SourceQuery{AnyFee: true, Listings: []Listing{ListingSell, ListingBuy}})
+
+	expected := []struct {
+		Category string
+		Listing  Listing
+	}{
+		{turnipexchange.CategoryTurnips, ListingSell},
+		{turnipexchange.CategoryDaisy, ListingBuy},
+		{turnipexchange.CategoryTurnips, ListingSell},
+	}
+	for idx, run := range expected {
+		islands, covered, err := source.RunPartial(ctx)
+		if err != nil {
+			t.Fatalf("Expected error to be nil but received %v", err)
+		}
+
+		if len(categories) != idx+1 || categories[idx] != run.Category {
+			t.Fatalf("Expected run %d to only request %q but requests were %q", idx, run.Category, categories)
+		}
+		for _, island := range islands {
+			if island.Listing != run.Listing {
+				t.Errorf("Expected island %s to be a %s listing but found %s", island.ID, run.Listing, island.Listing)
+			}
+		}
+
+		other := ListingBuy
+		if run.Listing == ListingBuy {
+			other = ListingSell
+		}
+		if !covered(Island{Listing: run.Listing, Fee: 1}) || covered(Island{Listing: other}) {
+			t.Errorf("Expected run %d to only cover %s listings", idx, run.Listing)
+		}
+
+		// Skip the wait for the next request.
+		source.lastRateLimit = TurnipExchangeRateLimit{}
+	}
+}
@@ -1,116 +1,193 @@
 package main
 
 import (
-	"errors"
-	"fmt"
-	"log"
+	"sync"
+	"time"
 )
 
 const (
 	defaultMinTurnipPriceAllowed = 15
 	defaultMaxTurnipPriceAllowed = 800
+	defaultSourceTimeout         = 30 * time.Second
+	defaultSourceRetries         = 2
+	defaultSourceRetryDelay      = time.Second
+	defaultSourceBackoff         = time.Minute
+	defaultIslandCloseGrace      = 5 * time.Minute
+	defaultIslandRetention       = time.Hour
+	defaultNotifyTimeout         = 30 * time.Second
+	defaultPollInterval          = time.Second
 )
 
+// TurnipFinder is safe for concurrent use once it has been configured. Chat
+// commands may run on transport goroutines while sources are being polled.
 type TurnipFinder struct {
 	Config                TurnipFinderConfig
-	Users                 map[string]User
-	Islands               map[string]Island
-	Sources               []IslandSource
+	Users                 UserStore
+	History               HistoryStore
+	Channels              ChannelStore
 	MinTurnipPriceAllowed int
 	MaxTurnipPriceAllowed int
 	SendUserMessage       SendUserMessage
-	commands              map[string]ChatCommand
+	SendChannelMessage    SendChannelMessage
+	Clock                 Clock
+	// DefaultNotifier sends islands to users who have not chosen notifiers.
+	DefaultNotifier string
+	mu              sync.RWMutex
+	islands         map[string]Island
+	sources         []*sourceState
+	commands        map[string]Command
+	commandAliases  map[string]string
+	expressions     map[string]*FilterExpression
+	templates       map[string]cachedTemplate
+	notifiers       map[string]Notifier
+	confirmations   map[string]pendingTarget
 }
 
 type TurnipFinderConfig struct {
+	// SourceTimeout bounds a single IslandSource.Run. A source that takes
+	// longer is skipped for the cycle and counted as a failure.
+	SourceTimeout time.Duration
+	// SourceRetries is how many times a transient failure is retried within
+	// a single poll.
+	SourceRetries int
+	// SourceRetryDelay is the wait before the first retry. It doubles for
+	// each retry after that.
+	SourceRetryDelay time.Duration
+	// SourceBackoff is used when a rate limited source does not say how long
+	// to wait.
+	SourceBackoff time.Duration
+	// IslandCloseGrace is how long an island may be missing from its
+	// source's results before it is marked closed.
+	IslandCloseGrace time.Duration
+	// IslandRetention is how long closed islands are remembered.
+	IslandRetention time.Duration
+	// NotifyTimeout bounds a single Notifier.Send.
+	NotifyTimeout time.Duration
+	// PollInterval is the time between polls in Run.
+	PollInterval time.Duration
 }
 
-type IslandSource interface {
-	Name() string
-	Run() []Island
-}
-
-type Island struct {
-	ID          string
-	Name        string
-	TurnipPrice int
-	MaxQueue    int
-	URL         string
-	Fee         int
-	Islander    string
-	Category    string
-	IslandTime  string
-	CreateTime  string // Change to date format
-	Description string
-	InQueue     int
-}
-
-type SendUserMessage func(user User, message string) error
+// SendUserMessage sends a message to a user. It defaults to
+// TurnipFinder.NotifyUser.
+type SendUserMessage func(user User, message Message) error
 
 func New() *TurnipFinder {
-	return &TurnipFinder{
+	store := NewMemoryStore()
+
+	tf := &TurnipFinder{
+		Config: TurnipFinderConfig{
+			SourceTimeout:    defaultSourceTimeout,
+			SourceRetries:    defaultSourceRetries,
+			SourceRetryDelay: defaultSourceRetryDelay,
+			SourceBackoff:    defaultSourceBackoff,
+			IslandCloseGrace: defaultIslandCloseGrace,
+			IslandRetention:  defaultIslandRetention,
+			NotifyTimeout:    defaultNotifyTimeout,
+			PollInterval:     defaultPollInterval,
+		},
 		MinTurnipPriceAllowed: defaultMinTurnipPriceAllowed,
 		MaxTurnipPriceAllowed: defaultMaxTurnipPriceAllowed,
-		Sources:               make([]IslandSource, 0),
-		Users:                 make(map[string]User),
-		Islands:               make(map[string]Island),
-		commands:              make(map[string]ChatCommand),
-	}
-}
-
-func (tf *TurnipFinder) PollSources() []Island {
-	// TODO: Move to goroutines
-	newIslands := make([]Island, 0)
-
-	for idx := range tf.Sources {
-		islands := tf.Sources[idx].Run()
-		for _, island := range islands {
-			err := tf.AddIsland(island)
-			if err != nil {
-				log.Printf("Could not add Island from %s.\tName: %q\tURL: %s\n", tf.Sources[idx].Name(), island.Name, island.URL)
-				log.Println(err)
-				continue
-			}
-
-			newIslands = append(newIslands, island)
-			tf.Islands[island.ID] = island
-		}
-
+		Users:                 store,
+		History:               store,
+		Channels:              store,
+		sources:               make([]*sourceState, 0),
+		islands:               make(map[string]Island),
+		commands:              make(map[string]Command),
+		commandAliases:        make(map[string]string),
+		expressions:           make(map[string]*FilterExpression),
+		templates:             make(map[string]cachedTemplate),
+		notifiers:             make(map[string]Notifier),
+		confirmations:         make(map[string]pendingTarget),
+		Clock:                 realClock{},
 	}
+	tf.SendUserMessage = tf.NotifyUser
 
-	return newIslands
+	return tf
 }
 
-func (tf *TurnipFinder) AddSource(source IslandSource) {
-	tf.Sources = append(tf.Sources, source)
+func (tf *TurnipFinder) now() time.Time {
+	return tf.Clock.Now()
 }
 
-func (tf *TurnipFinder) PollingUsers() []User {
+func (tf *TurnipFinder) PollingUsers() ([]User, error) {
 	users := make([]User, 0)
 
-	for _, user := range tf.Users {
+	allUsers, err := tf.Users.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range allUsers {
 		if user.Polling {
 			users = append(users, user)
 		}
 	}
 
-	return users
+	return users, nil
 }
 
+// SendUserIsland sends the island unless it has already been sent to the
+// user.
 func (tf *TurnipFinder) SendUserIsland(user User, island Island) error {
-	msg := fmt.Sprintf("[%d/%d] %s \tPrice: %d\nURL: %s\nFee: %d\n%s\n", island.InQueue, island.MaxQueue, island.Name, island.TurnipPrice, island.URL, island.Fee, island.Description)
-	err := tf.SendUserMessage(user, msg)
+	return tf.SendUserIslandEvent(user, Watch{}, IslandEvent{Type: IslandAdded, Island: island})
+}
 
-	return err
+// SendUserIslandEvent notifies the user about an island event. Updates are
+// sent even if the island was sent before, since the user asked for them.
+// Closed islands are only reported to users who were sent them. Messages for
+// a named watch start with the watch name.
+func (tf *TurnipFinder) SendUserIslandEvent(user User, watch Watch, event IslandEvent) error {
+	return tf.sendIslandEvent(islandRecipient{
+		historyID: user.ID,
+		format:    user.Format,
+		send: func(msg Message) error {
+			return tf.SendUserMessage(user, msg)
+		},
+	}, watch, event)
 }
 
-func (tf *TurnipFinder) AddIsland(island Island) error {
-	if island.ID == "" {
-		return errors.New("Island must have ID")
-	} else if island.URL == "" {
-		return errors.New("Island must have URL")
+// islandRecipient is a user or channel islands are sent to. historyID is
+// where the islands sent to it are recorded and format is used unless the
+// watch has its own.
+type islandRecipient struct {
+	historyID string
+	format    string
+	send      func(message Message) error
+}
+
+func (tf *TurnipFinder) sendIslandEvent(recipient islandRecipient, watch Watch, event IslandEvent) error {
+	switch event.Type {
+	case IslandAdded:
+		_, sent, err := tf.SentIsland(recipient.historyID, event.Island.ID)
+		if err != nil || sent {
+			return err
+		}
+
+		return tf.sendIsland(recipient, watch, event.Island, "")
+	case IslandUpdated:
+		return tf.sendIsland(recipient, watch, event.Island, "Updated: ")
+	case IslandRemoved:
+		_, sent, err := tf.SentIsland(recipient.historyID, event.Island.ID)
+		if err != nil || !sent {
+			return err
+		}
+
+		return recipient.send(RenderClosedIslandMessage(event.Island, watch))
 	}
 
-	tf.Islands[island.ID] = island
 	return nil
 }
+
+func (tf *TurnipFinder) sendIsland(recipient islandRecipient, watch Watch, island Island, prefix string) error {
+	format := watch.Style
+	if format == "" {
+		format = recipient.format
+	}
+
+	err := recipient.send(tf.renderIslandMessage(recipient.historyID, island, format, watchPrefix(watch)+prefix))
+	if err != nil {
+		return err
+	}
+
+	return tf.History.AddHistory(recipient.historyID, NewHistoryEntry(island, tf.now()))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+type staticSource struct {
+	name    string
+	islands []Island
+}
+
+func (s *staticSource) Name() string {
+	if s.name != "" {
+		return s.name
+	}
+
+	return "Static"
+}
+
+func (s *staticSource) Run(ctx context.Context) ([]Island, error) {
+	return s.islands, nil
+}
+
+func testIslands(count int) []Island {
+	islands := make([]Island, 0, count)
+	for i := 0; i < count; i++ {
+		islands = append(islands, Island{
+			ID:          fmt.Sprintf("island%d", i),
+			Name:        fmt.Sprintf("Island %d", i),
+			URL:         fmt.Sprintf("https://example.com/island/%d", i),
+			TurnipPrice: 100 + i*10,
+			MaxQueue:    20,
+			InQueue:     i,
+		})
+	}
+
+	return islands
+}
+
+// Run with -race to detect unsynchronised access to TurnipFinder state.
+func TestConcurrentCommandsAndPolling(t *testing.T) {
+	tf := New()
+	tf.RegisterDefaultCommands()
+	tf.AddSource(&staticSource{islands: testIslands(10)})
+
+	commands := []ChatCommandInput{
+		{Name: "sell", Args: "400"},
+		{Name: "buy", Args: "90"},
+		{Name: "maxqueue", Args: "5"},
+		{Name: "status"},
+		{Name: "help"},
+		{Name: "stop"},
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			userID := fmt.Sprintf("user%d", worker%4)
+			for i := 0; i < 50; i++ {
+				user, err := tf.User(userID)
+				if err != nil {
+					user, err = tf.AddUser(userID)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+				}
+
+				input := commands[(worker+i)%len(commands)]
+				input.User = user
+				input.Reply = func(string) error { return nil }
+				err = tf.RunCommand(input)
+				if err != nil {
+					t.Error(err)
+				}
+			}
+		}(worker)
+	}
+
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 50; i++ {
+				tf.PollSources(context.Background())
+				users, err := tf.PollingUsers()
+				if err != nil {
+					t.Error(err)
+				}
+				for _, user := range users {
+					user.ExcludePrices = append(user.ExcludePrices, i)
+				}
+				tf.Islands()
+				tf.Island("island0")
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if len(tf.Islands()) != 10 {
+		t.Errorf("Expected 10 islands but found %d", len(tf.Islands()))
+	}
+}
@@ -1,5 +1,11 @@
 package main
 
+import (
+	"strings"
+)
+
+const defaultUserNotifyOn = IslandAdded
+
 type User struct {
 	ID            string
 	Name          string
@@ -8,6 +14,46 @@ type User struct {
 	BuyPrice      int
 	ExcludePrices []int
 	MaxInQueue    int
+	NotifyOn      IslandEventType
+	FilterExpr    string
+	MaxFee        int
+	Watches       []Watch
+	// Format is a preset name or custom template for notifications.
+	Format string
+	// NotifyVia lists where the user is sent islands. Empty uses the
+	// default notifier.
+	NotifyVia []NotifyTarget
+}
+
+func (u User) Copy() User {
+	if u.ExcludePrices != nil {
+		u.ExcludePrices = append([]int(nil), u.ExcludePrices...)
+	}
+	if u.Watches != nil {
+		u.Watches = append([]Watch(nil), u.Watches...)
+	}
+	if u.NotifyVia != nil {
+		u.NotifyVia = append([]NotifyTarget(nil), u.NotifyVia...)
+	}
+
+	return u
+}
+
+// UserID qualifies a transport's account ID, like discord:123, so accounts
+// from different transports never share a user.
+func UserID(transport string, accountID string) string {
+	return transport + ":" + accountID
+}
+
+// SplitUserID returns the transport and account ID of a user ID. IDs without
+// a transport return an empty transport.
+func SplitUserID(ID string) (string, string) {
+	idx := strings.Index(ID, ":")
+	if idx < 0 {
+		return "", ID
+	}
+
+	return ID[:idx], ID[idx+1:]
 }
 
 type ErrorUserNotFound struct{}
@@ -16,8 +62,8 @@ func (e *ErrorUserNotFound) Error() string {
 	return "User was not found"
 }
 
-func (tf *TurnipFinder) AddUserWithName(ID string, Name string) User {
-	tf.Users[ID] = User{
+func (tf *TurnipFinder) AddUserWithName(ID string, Name string) (User, error) {
+	user := User{
 		ID:            ID,
 		Name:          Name,
 		SellPrice:     0,
@@ -25,23 +71,46 @@ func (tf *TurnipFinder) AddUserWithName(ID string, Name string) User {
 		ExcludePrices: []int{666},
 		MaxInQueue:    -1,
 		Polling:       false,
+		NotifyOn:      defaultUserNotifyOn,
+		MaxFee:        -1,
+	}
+
+	err := tf.Users.Put(user)
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// TransportUser returns the user for an account on a transport, adding them
+// on first contact. New users are named after the account ID when name is
+// empty.
+func (tf *TurnipFinder) TransportUser(transport string, accountID string, name string) (User, error) {
+	if accountID == "" {
+		return User{}, &ErrorUserNotFound{}
+	}
+
+	ID := UserID(transport, accountID)
+	user, err := tf.User(ID)
+	if _, ok := err.(*ErrorUserNotFound); !ok {
+		return user, err
+	}
+	if name == "" {
+		name = accountID
 	}
 
-	return tf.Users[ID]
+	return tf.AddUserWithName(ID, name)
 }
 
-func (tf *TurnipFinder) AddUser(ID string) User {
+func (tf *TurnipFinder) AddUser(ID string) (User, error) {
 	return tf.AddUserWithName(ID, ID)
 }
 
-func (tf *TurnipFinder) SetUser(user User) {
-	tf.Users[user.ID] = user
+func (tf *TurnipFinder) SetUser(user User) error {
+	return tf.Users.Put(user)
 }
 
 func (tf *TurnipFinder) User(ID string) (User, error) {
-	if user, ok := tf.Users[ID]; ok {
-		return user, nil
-	}
-
-	return User{}, &ErrorUserNotFound{}
+	return tf.Users.Get(ID)
 }
@@ -22,10 +22,10 @@ func TestAddUserWithName(t *testing.T) {
 			Name: "Add additional users",
 			tf: func() *TurnipFinder {
 				newTf := New()
-				newTf.Users["bar"] = User{
+				newTf.Users.Put(User{
 					ID:   "bar",
 					Name: "bar user",
-				}
+				})
 
 				return newTf
 			}(),
@@ -46,13 +46,14 @@ func TestAddUserWithName(t *testing.T) {
 
 			tcase.tf.AddUserWithName(tcase.UserID, tcase.UserName)
 
-			if len(tcase.tf.Users) != len(tcase.ExpectedUsers) {
-				t.Errorf("Expected to find %d users but found %d", len(tcase.tf.Users), len(tcase.ExpectedUsers))
+			users, _ := tcase.tf.Users.List()
+			if len(users) != len(tcase.ExpectedUsers) {
+				t.Errorf("Expected to find %d users but found %d", len(tcase.ExpectedUsers), len(users))
 			}
 
 			for _, expectedUser := range tcase.ExpectedUsers {
-				user, ok := tcase.tf.Users[expectedUser.ID]
-				if !ok {
+				user, err := tcase.tf.Users.Get(expectedUser.ID)
+				if err != nil {
 					t.Errorf("Could not find user with ID %s", expectedUser.ID)
 				} else if user.ID != expectedUser.ID {
 					t.Errorf("Expected user at index %s to have ID %s but found %s", expectedUser.ID, expectedUser.ID, user.ID)
@@ -89,13 +90,14 @@ func TestAddUser(t *testing.T) {
 
 			tcase.tf.AddUser(tcase.UserID)
 
-			if len(tcase.tf.Users) != len(tcase.ExpectedUsers) {
-				t.Errorf("Expected to find %d users but found %d", len(tcase.tf.Users), len(tcase.ExpectedUsers))
+			users, _ := tcase.tf.Users.List()
+			if len(users) != len(tcase.ExpectedUsers) {
+				t.Errorf("Expected to find %d users but found %d", len(tcase.ExpectedUsers), len(users))
 			}
 
 			for _, expectedUser := range tcase.ExpectedUsers {
-				user, ok := tcase.tf.Users[expectedUser.ID]
-				if !ok {
+				user, err := tcase.tf.Users.Get(expectedUser.ID)
+				if err != nil {
 					t.Errorf("Could not find user with ID %s", expectedUser.ID)
 				} else if user.ID != expectedUser.ID {
 					t.Errorf("Expected user at index %s to have ID %s but found %s", expectedUser.ID, expectedUser.ID, user.ID)
@@ -131,13 +133,14 @@ func TestSetUser(t *testing.T) {
 
 			tcase.tf.SetUser(tcase.User)
 
-			if len(tcase.tf.Users) != len(tcase.ExpectedUsers) {
-				t.Errorf("Expected to find %d users but found %d", len(tcase.tf.Users), len(tcase.ExpectedUsers))
+			users, _ := tcase.tf.Users.List()
+			if len(users) != len(tcase.ExpectedUsers) {
+				t.Errorf("Expected to find %d users but found %d", len(tcase.ExpectedUsers), len(users))
 			}
 
 			for _, expectedUser := range tcase.ExpectedUsers {
-				user, ok := tcase.tf.Users[expectedUser.ID]
-				if !ok {
+				user, err := tcase.tf.Users.Get(expectedUser.ID)
+				if err != nil {
 					t.Errorf("Could not find user with ID %s", expectedUser.ID)
 				} else if user.ID != expectedUser.ID {
 					t.Errorf("Expected user at index %s to have ID %s but found %s", expectedUser.ID, expectedUser.ID, user.ID)
@@ -168,7 +171,7 @@ func TestUser(t *testing.T) {
 			Name: "Returns the requested User object",
 			tf: func() *TurnipFinder {
 				newTf := New()
-				newTf.Users["foo"] = createTestUser()
+				newTf.Users.Put(createTestUser())
 
 				return newTf
 			}(),
@@ -179,7 +182,7 @@ func TestUser(t *testing.T) {
 			Name: "Returns an error if the user was not found",
 			tf: func() *TurnipFinder {
 				newTf := New()
-				newTf.Users["foo"] = createTestUser()
+				newTf.Users.Put(createTestUser())
 
 				return newTf
 			}(),
@@ -219,3 +222,46 @@ func TestUser(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitUserID(t *testing.T) {
+	testTable := []struct {
+		ID                string
+		ExpectedTransport string
+		ExpectedAccountID string
+	}{
+		{ID: UserID(NotifierDiscord, "123"), ExpectedTransport: "discord", ExpectedAccountID: "123"},
+		{ID: "telegram:456", ExpectedTransport: "telegram", ExpectedAccountID: "456"},
+		{ID: "slack:T1:U2", ExpectedTransport: "slack", ExpectedAccountID: "T1:U2"},
+		{ID: "789", ExpectedTransport: "", ExpectedAccountID: "789"},
+	}
+
+	for _, tcase := range testTable {
+		t.Run(tcase.ID, func(t *testing.T) {
+			transport, accountID := SplitUserID(tcase.ID)
+			if transport != tcase.ExpectedTransport || accountID != tcase.ExpectedAccountID {
+				t.Errorf("Expected %q and %q but received %q and %q", tcase.ExpectedTransport, tcase.ExpectedAccountID, transport, accountID)
+			}
+		})
+	}
+}
+
+func TestTransportUser(t *testing.T) {
+	tf := New()
+
+	user, err := tf.TransportUser(NotifierTelegram, "456", "")
+	if err != nil || user.ID != "telegram:456" || user.Name != "456" {
+		t.Fatalf("Expected a new user named after the account but received %+v, %v", user, err)
+	}
+
+	user.SellPrice = 500
+	tf.SetUser(user)
+	user, err = tf.TransportUser(NotifierTelegram, "456", "tom")
+	if err != nil || user.SellPrice != 500 || user.Name != "456" {
+		t.Errorf("Expected the existing user but received %+v, %v", user, err)
+	}
+
+	_, err = tf.TransportUser(NotifierSlack, "", "")
+	if _, ok := err.(*ErrorUserNotFound); !ok {
+		t.Errorf("Expected ErrorUserNotFound without an account ID but received %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+const defaultMaxUserWatches = 10
+
+var watchNameRegex = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Watch is a named filter expression a user is notified about in addition to
+// their default settings. Each watch has its own listing and can be paused
+// without being removed. Style names a format preset used instead of the
+// user's format.
+type Watch struct {
+	Name    string
+	Expr    string
+	Listing Listing
+	Style   string
+	Paused  bool
+}
+
+func (w Watch) String() string {
+	msg := fmt.Sprintf("%s (%s): %s", w.Name, w.Listing, w.Expr)
+	if w.Style != "" {
+		msg = fmt.Sprintf("%s (%s, %s): %s", w.Name, w.Listing, w.Style, w.Expr)
+	}
+	if w.Paused {
+		msg += " [paused]"
+	}
+
+	return msg
+}
+
+// FormatWatchName lowercases a watch name and reports whether it is valid.
+func FormatWatchName(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return name, watchNameRegex.MatchString(name)
+}
+
+// HasDefaultWatch reports whether the user's own settings describe islands to
+// look for, as opposed to only having named watches.
+func (u User) HasDefaultWatch() bool {
+	return u.SellPrice > 0 || u.BuyPrice > 0 || u.FilterExpr != ""
+}
+
+// WatchIndex returns the index of the named watch or -1.
+func (u User) WatchIndex(name string) int {
+	for idx, watch := range u.Watches {
+		if watch.Name == name {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+// ActiveWatches returns the user's watches that are not paused.
+func (u User) ActiveWatches() []Watch {
+	watches := make([]Watch, 0, len(u.Watches))
+	for _, watch := range u.Watches {
+		if !watch.Paused {
+			watches = append(watches, watch)
+		}
+	}
+
+	return watches
+}
+
+type userWatch struct {
+	Watch
+	filter Filter
+}
+
+// userWatches returns the default watch, if the user has one, followed by
+// each active named watch. The default watch has no name. Named watches only
+// share the user's excluded prices; everything else comes from the watch. A
+// watch whose expression checks the listing is not limited to its own.
+func (tf *TurnipFinder) userWatches(user User) []userWatch {
+	watches := make([]userWatch, 0, len(user.Watches)+1)
+	if user.HasDefaultWatch() {
+		watches = append(watches, userWatch{filter: tf.UserFilter(user)})
+	}
+
+	for _, watch := range user.ActiveWatches() {
+		expr, err := tf.expression(user.ID+"/"+watch.Name, watch.Expr)
+		if err != nil {
+			log.Printf("Invalid watch %s for user %s: %v\n", watch.Name, user.ID, err)
+			continue
+		}
+
+		filters := []Filter{expr.Filter(tf.now)}
+		if !expr.UsesField("listing") {
+			filters = append(filters, ListingFilter(watch.Listing))
+		}
+		if len(user.ExcludePrices) > 0 {
+			filters = append(filters, ExcludePricesFilter(user.ExcludePrices))
+		}
+
+		watches = append(watches, userWatch{Watch: watch, filter: AllFilters(filters...)})
+	}
+
+	return watches
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+const (
+	webhookTimeout        = 30 * time.Second
+	webhookResolveTimeout = 5 * time.Second
+)
+
+// webhookBlockedNetworks are addresses users may not point webhooks at, so
+// the bot cannot be used to reach services on its own network.
+var webhookBlockedNetworks = []string{
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"fc00::/7",
+}
+
+// WebhookNotifier POSTs messages as JSON to the recipient URL. The client from
+// NewWebhookNotifier refuses to connect to local addresses, whatever a
+// hostname resolves to when the message is sent, and does not follow
+// redirects.
+type WebhookNotifier struct {
+	Client *http.Client
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// WebhookPayload is the JSON body sent to webhooks.
+type WebhookPayload struct {
+	Text  string        `json:"text"`
+	Embed *WebhookEmbed `json:"embed,omitempty"`
+	// Link is the address of the island, if the message is about one.
+	Link string `json:"link,omitempty"`
+}
+
+type WebhookEmbed struct {
+	Title       string         `json:"title"`
+	URL         string         `json:"url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []WebhookField `json:"fields,omitempty"`
+	Footer      string         `json:"footer,omitempty"`
+}
+
+type WebhookField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type ErrorWebhookStatus struct {
+	StatusCode int
+}
+
+func (e *ErrorWebhookStatus) Error() string {
+	return fmt.Sprintf("Webhook responded with status %d", e.StatusCode)
+}
+
+func NewWebhookNotifier() *WebhookNotifier {
+	return &WebhookNotifier{
+		Client: newWebhookClient(webhookDialControl),
+		lookup: net.DefaultResolver.LookupIPAddr,
+	}
+}
+
+// newWebhookClient makes a client that checks every connection with control
+// and returns redirects as they are rather than following them.
+func newWebhookClient(control func(network string, address string, c syscall.RawConn) error) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout, Control: control}
+
+	return &http.Client{
+		Timeout: webhookTimeout,
+		// No proxy, so the dialer sees the webhook's own address.
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// webhookDialControl runs after the hostname is resolved, so it sees the
+// address actually being connected to.
+func webhookDialControl(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	return checkWebhookIP(net.ParseIP(host))
+}
+
+func checkWebhookIP(ip net.IP) error {
+	if ip == nil || ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("Webhooks cannot use local addresses")
+	}
+	for _, cidr := range webhookBlockedNetworks {
+		_, network, _ := net.ParseCIDR(cidr)
+		if network.Contains(ip) {
+			return fmt.Errorf("Webhooks cannot use local addresses")
+		}
+	}
+
+	return nil
+}
+
+func (n *WebhookNotifier) Capabilities() NotifierCapabilities {
+	return NotifierCapabilities{Embeds: true}
+}
+
+func (n *WebhookNotifier) Send(ctx context.Context, recipient string, message Message) error {
+	body, err := json.Marshal(NewWebhookPayload(message))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, recipient, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &ErrorWebhookStatus{StatusCode: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// ValidateRecipient accepts http and https URLs whose host is not on a
+// private network. Hostnames are resolved, and checked again on every send in
+// case they change.
+func (n *WebhookNotifier) ValidateRecipient(recipient string) error {
+	u, err := url.Parse(recipient)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("Webhooks must be http or https URLs")
+	}
+
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		return checkWebhookIP(ip)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookResolveTimeout)
+	defer cancel()
+
+	addrs, err := n.lookup(ctx, u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("Could not find %s", u.Hostname())
+	}
+	for _, addr := range addrs {
+		err := checkWebhookIP(addr.IP)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func NewWebhookPayload(message Message) WebhookPayload {
+	payload := WebhookPayload{Text: message.Text}
+	if message.Embed == nil {
+		return payload
+	}
+
+	embed := message.Embed
+	payload.Embed = &WebhookEmbed{
+		Title:       embed.Title,
+		URL:         embed.URL,
+		Description: embed.Description,
+		Color:       embed.Color,
+		Footer:      embed.Footer,
+	}
+	for _, field := range embed.Fields {
+		payload.Embed.Fields = append(payload.Embed.Fields, WebhookField{Name: field.Name, Value: field.Value, Inline: field.Inline})
+	}
+	payload.Link = embed.Link
+
+	return payload
+}
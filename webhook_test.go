@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+)
+
+func TestWebhookNotifierSend(t *testing.T) {
+	var received WebhookPayload
+	var contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	// The test server is local, which the notifier's own client refuses.
+	notifier := &WebhookNotifier{Client: server.Client()}
+	island := Island{Name: "Nook", TurnipPrice: 512, InQueue: 4, MaxQueue: 20, URL: "https://example.com/island/1"}
+	message := New().RenderIslandMessage(island, FormatFull, "")
+
+	err := notifier.Send(context.Background(), server.URL+"/hook", message)
+	if err != nil {
+		t.Fatalf("Expected error to be nil but received %v", err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Expected a JSON request but received %q", contentType)
+	}
+	if received.Text != message.Text || received.Link != island.URL {
+		t.Errorf("Unexpected payload %+v", received)
+	}
+	if received.Embed == nil || received.Embed.Title != "Nook" || len(received.Embed.Fields) != 3 {
+		t.Errorf("Unexpected embed %+v", received.Embed)
+	}
+
+	err = notifier.Send(context.Background(), server.URL+"/broken", message)
+	var statusErr *ErrorWebhookStatus
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected ErrorWebhookStatus but received %v", err)
+	}
+
+	err = NewWebhookNotifier().Send(context.Background(), server.URL+"/hook", message)
+	if err == nil {
+		t.Error("Expected sending to a local address to fail")
+	}
+}
+
+func TestWebhookNotifierRedirect(t *testing.T) {
+	followed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			followed = true
+			return
+		}
+		http.Redirect(w, r, "/internal", http.StatusFound)
+	}))
+	defer server.Close()
+
+	allowAll := func(network string, address string, c syscall.RawConn) error {
+		return nil
+	}
+	notifier := &WebhookNotifier{Client: newWebhookClient(allowAll)}
+
+	err := notifier.Send(context.Background(), server.URL+"/hook", TextMessage("hello"))
+	var statusErr *ErrorWebhookStatus
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusFound {
+		t.Errorf("Expected ErrorWebhookStatus for the redirect but received %v", err)
+	}
+	if followed {
+		t.Error("Expected the redirect not to be followed")
+	}
+}
+
+func TestWebhookNotifierValidateRecipient(t *testing.T) {
+	testTable := []struct {
+		Recipient string
+		Valid     bool
+	}{
+		{Recipient: "https://example.com/hook", Valid: true},
+		{Recipient: "http://203.0.113.7:8080/hook", Valid: true},
+		{Recipient: "ftp://example.com/hook"},
+		{Recipient: "example.com/hook"},
+		{Recipient: "http://127.0.0.1/hook"},
+		{Recipient: "http://[::1]/hook"},
+		{Recipient: "http://192.168.1.10/hook"},
+		{Recipient: "http://169.254.169.254/latest"},
+		{Recipient: "http://localhost:6379/"},
+		{Recipient: "http://metadata.google.internal/"},
+		{Recipient: "http://missing.example.com/hook"},
+	}
+
+	hosts := map[string]string{
+		"example.com":              "93.184.215.14",
+		"localhost":                "127.0.0.1",
+		"metadata.google.internal": "169.254.169.254",
+	}
+	notifier := NewWebhookNotifier()
+	notifier.lookup = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		ip, ok := hosts[host]
+		if !ok {
+			return nil, errors.New("no such host")
+		}
+		return []net.IPAddr{{IP: net.ParseIP(ip)}}, nil
+	}
+	for _, tcase := range testTable {
+		t.Run(tcase.Recipient, func(t *testing.T) {
+			err := notifier.ValidateRecipient(tcase.Recipient)
+			if (err == nil) != tcase.Valid {
+				t.Errorf("Expected valid to be %t but received %v", tcase.Valid, err)
+			}
+		})
+	}
+}